@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dot-5g/sepp/pkg/pki"
+)
+
+// listFlag is a flag taking comma separated values, which can be
+// repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// issueFlags describe the SEPP certificates to issue.
+type issueFlags struct {
+	dir      string
+	hosts    listFlag
+	n32Hosts listFlag
+	sbiHosts listFlag
+	plmns    listFlag
+	keyType  string
+	validity time.Duration
+}
+
+func addIssueFlags(flags *flag.FlagSet) *issueFlags {
+	issue := &issueFlags{}
+	flags.StringVar(&issue.dir, "dir", "certs", "Directory the certificates are written to")
+	flags.Var(&issue.hosts, "hosts", "Comma separated DNS names and IP addresses all certificates are valid for (default \"localhost,127.0.0.1\" when no hosts are given), can be repeated")
+	flags.Var(&issue.n32Hosts, "n32-hosts", "Comma separated DNS names and IP addresses only the N32 server and client certificates are valid for, can be repeated")
+	flags.Var(&issue.sbiHosts, "sbi-hosts", "Comma separated DNS names and IP addresses only the SBI server certificate is valid for, can be repeated")
+	flags.Var(&issue.plmns, "plmn", "PLMN ID as MCC-MNC whose SEPP FQDN the certificates are valid for, as in 001-01, can be repeated")
+	flags.StringVar(&issue.keyType, "key-type", string(pki.ECDSAP256), fmt.Sprintf("Type of the private keys, one of %v", pki.KeyTypes))
+	flags.DurationVar(&issue.validity, "validity", pki.DefaultValidity, "Validity of the certificates")
+	return issue
+}
+
+// options returns the options of the certificates, failing on invalid
+// PLMN IDs.
+func (issue *issueFlags) options() (pki.SEPPOptions, error) {
+	hosts := append([]string(nil), issue.hosts...)
+	if len(hosts) == 0 && len(issue.n32Hosts) == 0 && len(issue.sbiHosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+	}
+	for _, plmn := range issue.plmns {
+		mcc, mnc, ok := strings.Cut(plmn, "-")
+		if !ok || len(mcc) != 3 || len(mnc) < 2 || len(mnc) > 3 {
+			return pki.SEPPOptions{}, fmt.Errorf("invalid PLMN ID %q, expected MCC-MNC as in 001-01", plmn)
+		}
+		hosts = append(hosts, pki.SEPPFQDN(mcc, mnc))
+	}
+	return pki.SEPPOptions{
+		N32Hosts: append(append([]string(nil), hosts...), issue.n32Hosts...),
+		SBIHosts: append(append([]string(nil), hosts...), issue.sbiHosts...),
+		KeyType:  pki.KeyType(issue.keyType),
+		Validity: issue.validity,
+	}, nil
+}
+
+func certsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "missing certs command")
+		usage(os.Stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "init":
+		return initCerts(args[1:])
+	case "issue":
+		return issueCerts(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "unknown certs command %q\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+// initCerts creates a CA and issues the certificates of a SEPP with it.
+func initCerts(args []string) int {
+	flags := newFlagSet("certs init", "Create a CA and issue the N32 server, N32 client and SBI server certificates of a SEPP with it.")
+	issue := addIssueFlags(flags)
+	caValidity := flags.Duration("ca-validity", 10*pki.DefaultValidity, "Validity of the CA certificate")
+	force := flags.Bool("force", false, "Replace the CA of the directory if it has one")
+	if exitCode, ok := parseFlags(flags, args); !ok {
+		return exitCode
+	}
+	opts, err := issue.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	caCertPath, caKeyPath := filepath.Join(issue.dir, pki.CACertFile), filepath.Join(issue.dir, pki.CAKeyFile)
+	if _, err := os.Stat(caKeyPath); !*force && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "%s already exists, use certs issue to issue certificates with it or -force to replace it\n", caKeyPath)
+		return exitFailure
+	}
+	ca, err := pki.NewCA(pki.Options{CommonName: "SEPP CA", KeyType: opts.KeyType, Validity: *caValidity})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create CA: %v\n", err)
+		return exitFailure
+	}
+	if err := os.MkdirAll(issue.dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", issue.dir, err)
+		return exitFailure
+	}
+	if err := ca.WriteFiles(caCertPath, caKeyPath); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write CA: %v\n", err)
+		return exitFailure
+	}
+	if err := ca.IssueSEPP(issue.dir, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to issue certificates: %v\n", err)
+		return exitFailure
+	}
+	fmt.Printf("created a CA and issued %s in %s\n", strings.Join(pki.SEPPNames, ", "), issue.dir)
+	return exitOK
+}
+
+// issueCerts issues certificates of a SEPP with an existing CA, to renew
+// them or to create those of another SEPP.
+func issueCerts(args []string) int {
+	flags := newFlagSet("certs issue", "Issue certificates of a SEPP with an existing CA.")
+	issue := addIssueFlags(flags)
+	caCertPath := flags.String("ca-cert", filepath.Join("certs", pki.CACertFile), "Path to the CA certificate")
+	caKeyPath := flags.String("ca-key", filepath.Join("certs", pki.CAKeyFile), "Path to the CA private key")
+	names := listFlag{}
+	flags.Var(&names, "certs", fmt.Sprintf("Comma separated certificates to issue among %v (default all), can be repeated", pki.SEPPNames))
+	if exitCode, ok := parseFlags(flags, args); !ok {
+		return exitCode
+	}
+	opts, err := issue.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	ca, err := pki.Load(*caCertPath, *caKeyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load CA: %v\n", err)
+		return exitFailure
+	}
+	if err := ca.IssueSEPP(issue.dir, opts, names...); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to issue certificates: %v\n", err)
+		return exitFailure
+	}
+	if len(names) == 0 {
+		names = pki.SEPPNames
+	}
+	fmt.Printf("issued %s in %s\n", strings.Join(names, ", "), issue.dir)
+	return exitOK
+}
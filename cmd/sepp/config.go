@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dot-5g/sepp/config"
+	"gopkg.in/yaml.v2"
+)
+
+func configCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "missing config command")
+		usage(os.Stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "validate":
+		return validateConfig(args[1:])
+	case "schema":
+		return printSchema(args[1:])
+	case "print-effective":
+		return printEffectiveConfig(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "unknown config command %q\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+// validateConfig loads the configuration as serve does and reports every
+// violation found, one per line.
+func validateConfig(args []string) int {
+	flags := newFlagSet("config validate", "Check the configuration as serve loads it, exiting with 1 if it is invalid.")
+	addConfigFlags(flags)
+	if exitCode, ok := parseFlags(flags, args); !ok {
+		return exitCode
+	}
+
+	if _, err := loadConfig(); err != nil {
+		reportConfigError(err)
+		return exitFailure
+	}
+	fmt.Printf("%s is valid\n", configFilePath)
+	return exitOK
+}
+
+func printSchema(args []string) int {
+	flags := newFlagSet("config schema", "Print the JSON Schema of the config file.")
+	if exitCode, ok := parseFlags(flags, args); !ok {
+		return exitCode
+	}
+
+	schema, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal schema: %v\n", err)
+		return exitFailure
+	}
+	fmt.Println(string(schema))
+	return exitOK
+}
+
+func printEffectiveConfig(args []string) int {
+	flags := newFlagSet("config print-effective", "Print the configuration once the SEPP_ environment variables and -set flags are applied.")
+	addConfigFlags(flags)
+	if exitCode, ok := parseFlags(flags, args); !ok {
+		return exitCode
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		reportConfigError(err)
+		return exitFailure
+	}
+	data, err := yaml.Marshal(conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to marshal config: %v\n", err)
+		return exitFailure
+	}
+	fmt.Print(string(data))
+	return exitOK
+}
+
+func reportConfigError(err error) {
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configFilePath, err)
+		return
+	}
+	for _, fieldError := range validationErr.Errors {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configFilePath, fieldError)
+	}
+	if len(validationErr.Errors) == 1 {
+		fmt.Fprintf(os.Stderr, "%s is invalid: 1 error\n", configFilePath)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s is invalid: %d errors\n", configFilePath, len(validationErr.Errors))
+}
@@ -2,81 +2,105 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
-	"sync"
-	"time"
+	"os"
+	"strings"
 
 	"github.com/dot-5g/sepp/config"
-	"github.com/dot-5g/sepp/internal/model"
-	"github.com/dot-5g/sepp/internal/n32"
-	"github.com/dot-5g/sepp/internal/sbi"
 )
 
-var configFilePath string
+// Exit codes of the commands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
 
-func init() {
-	flag.StringVar(&configFilePath, "config", "config.yaml", "Path to the config file")
-}
+var (
+	configFilePath  string
+	configOverrides config.Overrides
+)
 
 func main() {
-	flag.Parse()
-	var wg sync.WaitGroup
-	conf, err := config.LoadConfiguration(configFilePath)
-	if err != nil {
-		log.Fatalf("failed to read config file: %s", err)
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command given by args and returns the exit code of
+// the process.
+func run(args []string) int {
+	// Flags without a command serve, as the SEPP always did.
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serve(args)
 	}
-	seppContext := &model.SEPPContext{
-		Mu:                          sync.Mutex{},
-		LocalN32FQDN:                model.FQDN(conf.SEPP.Local.N32.FQDN),
-		RemoteN32FQDN:               model.FQDN(""),
-		SupportedSecurityCapability: model.SecurityCapability("TLS"),
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "config":
+		return configCommand(args[1:])
+	case "certs":
+		return certsCommand(args[1:])
+	case "help":
+		usage(os.Stdout)
+		return exitOK
 	}
-	startN32Server(&wg, conf.SEPP.Local.N32, seppContext)
-	startSBIServer(&wg, conf.SEPP.Local.SBI, conf.SEPP.Remote.TLS, seppContext)
-	exchangeCapability(conf.SEPP.Remote.URL, conf.SEPP.Local.N32.FQDN, conf.SEPP.SecurityCapability, conf.SEPP.Remote.TLS, seppContext)
-	log.Printf("SEPP ready to serve")
-	wg.Wait()
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
 }
 
-func startN32Server(wg *sync.WaitGroup, n32Config config.N32, seppContext *model.SEPPContext) {
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		n32.StartServer(n32Config.GetAddress(), n32Config.TLS.Cert, n32Config.TLS.Key, n32Config.TLS.CA, n32Config.FQDN, seppContext)
-	}()
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: sepp <command> [flags]
+
+Commands:
+  serve                   Run the SEPP, the default when only flags are given
+  config validate         Check the configuration, exiting with 1 if it is invalid
+  config schema           Print the JSON Schema of the config file
+  config print-effective  Print the configuration once environment variables and -set flags are applied
+  certs init              Create a CA and issue the certificates of a SEPP with it
+  certs issue             Issue certificates of a SEPP with an existing CA
+
+Run sepp <command> -h for the flags of a command.
+`)
 }
 
-func startSBIServer(wg *sync.WaitGroup, sbiConfig config.SBI, clientTLS config.TLS, seppContext *model.SEPPContext) {
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		sbi.StartServer(sbiConfig.GetAddress(), sbiConfig.TLS.Cert, sbiConfig.TLS.Key, sbiConfig.TLS.CA, clientTLS.Cert, clientTLS.Key, seppContext)
-	}()
+// newFlagSet returns the flag set of a command, whose usage lists its
+// flags after summary.
+func newFlagSet(name string, summary string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: sepp %s [flags]\n\n%s\n\nFlags:\n", name, summary)
+		flags.PrintDefaults()
+	}
+	return flags
 }
 
-func exchangeCapability(remoteURL string, fqdn string, securityCapability string, n32TLSConf config.TLS, seppContext *model.SEPPContext) {
-	for {
-		seppContext.Mu.Lock()
-		selectedCapability := seppContext.SelectedSecurityCapability
-		seppContext.Mu.Unlock()
-		if selectedCapability != "" {
-			return
+// parseFlags parses args and returns the exit code to use if the command
+// must not run.
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
 		}
-		seppClient := n32.NewClient(n32TLSConf.Cert, n32TLSConf.Key, n32TLSConf.CA)
-		reqData := n32.SecNegotiateReqData{
-			Sender:                     model.FQDN(fqdn),
-			SupportedSecCapabilityList: []model.SecurityCapability{model.SecurityCapability(securityCapability)},
-		}
-		secNegotiateRspData, err := seppClient.POSTExchangeCapability(remoteURL, reqData)
-		if err != nil || secNegotiateRspData.SelectedSecCapability != model.TLS {
-			log.Printf("Failed to exchange capability: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		seppContext.Mu.Lock()
-		seppContext.RemoteN32FQDN = model.FQDN(secNegotiateRspData.Sender)
-		seppContext.SelectedSecurityCapability = secNegotiateRspData.SelectedSecCapability
-		seppContext.Mu.Unlock()
-		return
+		return exitUsage, false
 	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected argument %q\n", flags.Arg(0))
+		flags.Usage()
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// addConfigFlags registers the flags giving the configuration.
+func addConfigFlags(flags *flag.FlagSet) {
+	flags.StringVar(&configFilePath, "config", "config.yaml", "Path to the config file")
+	flags.Var(&configOverrides, "set", "Override a config field given by its YAML path, as in sepp.local.n32.port=1234 or sepp.remotes.0.url=https://sepp.example.com, can be repeated")
+}
+
+// loadConfig reads the config file and applies the SEPP_ environment
+// variables over it, then the -set flags over both.
+func loadConfig() (*config.Config, error) {
+	return config.Load(configFilePath, os.Environ(), configOverrides, log.Default())
 }
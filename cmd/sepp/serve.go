@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dot-5g/sepp/pkg/sepp"
+)
+
+var (
+	shutdownTimeout      time.Duration
+	terminateOnShutdown  bool
+	certReloadInterval   time.Duration
+	configReloadInterval time.Duration
+	configReloadTimeout  time.Duration
+)
+
+// serve starts the SEPP and serves until SIGTERM or SIGINT is received or
+// a server fails. The config file is reloaded when it changes, and with
+// the certificates on SIGHUP. It returns the exit code of the process.
+func serve(args []string) int {
+	flags := newFlagSet("serve", "Run the SEPP.")
+	addConfigFlags(flags)
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time given to in-flight requests to complete on shutdown")
+	flags.DurationVar(&certReloadInterval, "cert-reload-interval", sepp.DefaultCertReloadInterval, "How often certificate files are checked for changes, 0 to only reload on SIGHUP")
+	flags.DurationVar(&configReloadInterval, "config-reload-interval", 30*time.Second, "How often the config file is checked for changes, 0 to only reload on SIGHUP")
+	flags.DurationVar(&configReloadTimeout, "config-reload-timeout", 30*time.Second, "Time given to removed remote SEPPs to terminate their N32-f contexts on config reload")
+	flags.BoolVar(&terminateOnShutdown, "terminate-n32f", false, "Terminate the N32-f contexts with remote SEPPs on shutdown")
+	if exitCode, ok := parseFlags(flags, args); !ok {
+		return exitCode
+	}
+
+	conf, err := loadConfig()
+	if err != nil {
+		log.Fatalf("failed to read config file: %s", err)
+	}
+	opts := []sepp.Option{sepp.WithCertReloadInterval(certReloadInterval)}
+	if terminateOnShutdown {
+		opts = append(opts, sepp.WithN32fTermination())
+	}
+	s, err := sepp.New(*conf, opts...)
+	if err != nil {
+		log.Fatalf("failed to configure SEPP: %s", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if err := s.Start(ctx); err != nil {
+		log.Fatalf("failed to start SEPP: %s", err)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var configChanges <-chan time.Time
+	if configReloadInterval > 0 {
+		ticker := time.NewTicker(configReloadInterval)
+		defer ticker.Stop()
+		configChanges = ticker.C
+	}
+	configVersion := fileVersion(configFilePath)
+
+	exitCode := exitOK
+serve:
+	for {
+		select {
+		case <-hangup:
+			log.Printf("SEPP reloading configuration and certificates")
+			configVersion = fileVersion(configFilePath)
+			reloadConfig(ctx, s)
+			// Failures are logged and the previous certificates kept.
+			_ = s.ReloadCertificates()
+		case <-configChanges:
+			if version := fileVersion(configFilePath); version != configVersion {
+				configVersion = version
+				reloadConfig(ctx, s)
+			}
+		case <-ctx.Done():
+			log.Printf("SEPP shutting down")
+			break serve
+		case err := <-s.Err():
+			log.Printf("SEPP shutting down: %v", err)
+			exitCode = exitFailure
+			break serve
+		}
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Stop(shutdownCtx); err != nil {
+		log.Printf("failed to stop SEPP: %v", err)
+		exitCode = exitFailure
+	}
+	return exitCode
+}
+
+// fileVersion identifies the content of the file at path, the zero value
+// if it cannot be read.
+func fileVersion(path string) [2]int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return [2]int64{}
+	}
+	return [2]int64{info.ModTime().UnixNano(), info.Size()}
+}
+
+// reloadConfig applies the config file to s, keeping the configuration
+// in use if it is invalid.
+func reloadConfig(ctx context.Context, s *sepp.SEPP) {
+	conf, err := loadConfig()
+	if err != nil {
+		log.Printf("SEPP keeping previous configuration: failed to read config file: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, configReloadTimeout)
+	defer cancel()
+	if err := s.Reload(ctx, *conf); err != nil {
+		log.Printf("SEPP keeping previous configuration: %v", err)
+	}
+}
@@ -1,9 +1,21 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -22,31 +34,93 @@ type N32 struct {
 }
 
 type SBI struct {
+	FQDN string `yaml:"fqdn"`
 	Host string `yaml:"host"`
 	Port string `yaml:"port"`
 	TLS  TLS    `yaml:"tls"`
 }
 
+// Route sends the requests received from remote SEPPs whose path starts
+// with ApiPrefix to the local NF at ApiRoot. H2C makes the requests to an
+// http ApiRoot use HTTP/2 with prior knowledge instead of HTTP/1.1.
+type Route struct {
+	ApiPrefix string `yaml:"apiPrefix"`
+	ApiRoot   string `yaml:"apiRoot"`
+	H2C       bool   `yaml:"h2c"`
+}
+
 type Local struct {
-	N32 N32 `yaml:"n32"`
-	SBI SBI `yaml:"sbi"`
+	// PlmnID is the PLMN of the local NFs, which requests from remote
+	// SEPPs may name by their FQDN.
+	PlmnID PlmnID  `yaml:"plmnId"`
+	N32    N32     `yaml:"n32"`
+	SBI    SBI     `yaml:"sbi"`
+	Routes []Route `yaml:"routes"`
+}
+
+type PlmnID struct {
+	MCC string `yaml:"mcc"`
+	MNC string `yaml:"mnc"`
 }
 
 type Remote struct {
-	URL string `yaml:"url"`
-	TLS TLS    `yaml:"tls"`
+	PlmnID PlmnID `yaml:"plmnId"`
+	URL    string `yaml:"url"`
+	TLS    TLS    `yaml:"tls"`
+}
+
+type IeInfo struct {
+	IeLoc  string `yaml:"ieLoc"`
+	IeType string `yaml:"ieType"`
+	ReqIe  string `yaml:"reqIe"`
+	RspIe  string `yaml:"rspIe"`
+}
+
+type ApiIeMapping struct {
+	ApiSignature string   `yaml:"apiSignature"`
+	ApiMethod    string   `yaml:"apiMethod"`
+	IeList       []IeInfo `yaml:"ieList"`
+}
+
+type IpxProvider struct {
+	ID           string   `yaml:"id"`
+	Certificates []string `yaml:"certificates"`
+}
+
+type PRINS struct {
+	ApiIeMappingList  []ApiIeMapping `yaml:"apiIeMappingList"`
+	DataTypeEncPolicy []string       `yaml:"dataTypeEncPolicy"`
+	JweCipherSuites   []string       `yaml:"jweCipherSuites"`
+	JwsCipherSuites   []string       `yaml:"jwsCipherSuites"`
+	IpxProviders      []IpxProvider  `yaml:"ipxProviders"`
 }
 
 type SEPP struct {
-	SecurityCapability string `yaml:"securityCapability"`
-	Local              Local  `yaml:"local"`
-	Remote             Remote `yaml:"remote"`
+	SecurityCapabilities []string `yaml:"securityCapabilities"`
+	PRINS                PRINS    `yaml:"prins"`
+	Local                Local    `yaml:"local"`
+	Remotes              []Remote `yaml:"remotes"`
 }
 
 type Config struct {
 	SEPP SEPP `yaml:"sepp"`
 }
 
+var securityCapabilities = []string{"TLS", "PRINS", "NONE"}
+
+var ieLocations = []string{"URI_PARAM", "HEADER", "BODY"}
+
+var (
+	mccPattern = regexp.MustCompile(`^[0-9]{3}$`)
+	mncPattern = regexp.MustCompile(`^[0-9]{2,3}$`)
+)
+
+var jweCipherSuites = []string{"A256GCM", "A128GCM"}
+
+var jwsCipherSuites = []string{"ES256"}
+
+var ieTypes = []string{"UEID", "LOCATION", "KEY_MATERIAL", "AUTHENTICATION_MATERIAL", "AUTHORIZATION_TOKEN", "OTHER", "NONSENSITIVE"}
+
 func (n32 N32) GetAddress() string {
 	return n32.Host + ":" + n32.Port
 }
@@ -56,82 +130,364 @@ func (sbi SBI) GetAddress() string {
 }
 
 func ReadConfig(reader io.Reader) (*Config, error) {
-	var config Config
-
 	data, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config data: %w", err)
 	}
 
-	err = yaml.Unmarshal(data, &config)
+	var v validator
+	config, err := decode(data, &v)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		return nil, err
 	}
 
-	if err := validateConfig(&config); err != nil {
+	v.validateConfig(config)
+	if err := v.err(); err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	return config, nil
 }
 
-func validateConfig(config *Config) error {
+// Validate checks a configuration that was not read with ReadConfig.
+func (config *Config) Validate() error {
+	var v validator
+	v.validateConfig(config)
+	return v.err()
+}
 
-	if config.SEPP.SecurityCapability != "TLS" {
-		return fmt.Errorf("unsupported security capability, only TLS is supported")
+// FieldError is a violation of the configuration at the YAML path of a
+// field, such as sepp.local.sbi.tls.cert.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every violation found in a configuration.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldError := range e.Errors {
+		messages[i] = fieldError.Error()
 	}
+	return strings.Join(messages, "; ")
+}
 
-	if config.SEPP.Local.N32.FQDN == "" {
-		return fmt.Errorf("missing Local N32 FQDN")
+// validator collects the violations of a configuration.
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) addf(path string, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
 	}
+	return &ValidationError{Errors: v.errors}
+}
 
-	if config.SEPP.Local.N32.Host == "" {
-		return fmt.Errorf("missing Local N32 Host")
+// decode unmarshals data, reporting the keys that match no field to v.
+func decode(data []byte, v *validator) (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	if config.SEPP.Local.N32.Port == "" {
-		return fmt.Errorf("missing port")
+	var document any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	v.checkKeys("", reflect.TypeOf(config), document)
 
-	if config.SEPP.Local.N32.TLS.Cert == "" {
-		return fmt.Errorf("missing Local N32 TLS Cert")
+	return &config, nil
+}
+
+func (v *validator) checkKeys(path string, t reflect.Type, node any) {
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := node.(map[any]any)
+		if !ok {
+			return
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, fmt.Sprint(key))
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fieldPath := joinPath(path, key)
+			field, ok := fieldByKey(t, key)
+			if !ok {
+				v.addf(fieldPath, "unknown field")
+				continue
+			}
+			v.checkKeys(fieldPath, field.Type, fields[key])
+		}
+	case reflect.Slice:
+		items, ok := node.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			v.checkKeys(joinPath(path, strconv.Itoa(i)), t.Elem(), item)
+		}
 	}
+}
 
-	if config.SEPP.Local.N32.TLS.Key == "" {
-		return fmt.Errorf("missing Local N32 TLS Key")
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlKey(t.Field(i)) == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
 	}
+	return path + "." + key
+}
 
-	if config.SEPP.Local.N32.TLS.CA == "" {
-		return fmt.Errorf("missing Local N32 TLS CA")
+func (v *validator) validateConfig(config *Config) {
+	if len(config.SEPP.SecurityCapabilities) == 0 {
+		v.addf("sepp.securityCapabilities", "missing")
 	}
 
-	if config.SEPP.Remote.URL != "" {
-		if config.SEPP.Remote.TLS.Cert == "" {
-			return fmt.Errorf("missing Remote TLS Cert")
+	for i, securityCapability := range config.SEPP.SecurityCapabilities {
+		path := fmt.Sprintf("sepp.securityCapabilities.%d", i)
+		if !slices.Contains(securityCapabilities, securityCapability) {
+			v.addf(path, "unsupported security capability %s, supported values are %v", securityCapability, securityCapabilities)
+		}
+		if slices.Contains(config.SEPP.SecurityCapabilities[:i], securityCapability) {
+			v.addf(path, "duplicate security capability %s", securityCapability)
 		}
+	}
+
+	v.validatePRINS("sepp.prins", config.SEPP.PRINS)
+
+	if config.SEPP.Local.PlmnID != (PlmnID{}) {
+		v.validatePlmnID("sepp.local.plmnId", config.SEPP.Local.PlmnID)
+	}
+	if config.SEPP.Local.N32.FQDN == "" {
+		v.addf("sepp.local.n32.fqdn", "missing")
+	}
+	v.validateInterface("sepp.local.n32", config.SEPP.Local.N32.Host, config.SEPP.Local.N32.Port, config.SEPP.Local.N32.TLS)
+	v.validateInterface("sepp.local.sbi", config.SEPP.Local.SBI.Host, config.SEPP.Local.SBI.Port, config.SEPP.Local.SBI.TLS)
+	if config.SEPP.Local.SBI.Port != "0" && config.SEPP.Local.N32.GetAddress() == config.SEPP.Local.SBI.GetAddress() {
+		v.addf("sepp.local.sbi.port", "the N32 and SBI interfaces cannot listen on the same address %s", config.SEPP.Local.SBI.GetAddress())
+	}
+
+	for i, route := range config.SEPP.Local.Routes {
+		v.validateRoute(fmt.Sprintf("sepp.local.routes.%d", i), route)
+	}
+
+	for i, remote := range config.SEPP.Remotes {
+		path := fmt.Sprintf("sepp.remotes.%d", i)
+		v.validateRemote(path, remote)
 
-		if config.SEPP.Remote.TLS.Key == "" {
-			return fmt.Errorf("missing Remote TLS Key")
+		for j, other := range config.SEPP.Remotes[:i] {
+			if other.PlmnID == remote.PlmnID {
+				v.addf(path+".plmnId", "duplicate PLMN ID %s-%s, also used by sepp.remotes.%d", remote.PlmnID.MCC, remote.PlmnID.MNC, j)
+			}
+			if other.URL == remote.URL && remote.URL != "" {
+				v.addf(path+".url", "duplicate URL %s, also used by sepp.remotes.%d", remote.URL, j)
+			}
 		}
+	}
+}
+
+func (v *validator) validateInterface(path string, host string, port string, files TLS) {
+	if host == "" {
+		v.addf(path+".host", "missing")
+	}
+	v.validatePort(path+".port", port)
+	v.validateTLS(path+".tls", files)
+}
+
+// validatePort accepts 0, for which the system picks a free port.
+func (v *validator) validatePort(path string, port string) {
+	if port == "" {
+		v.addf(path, "missing")
+		return
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 0 || number > 65535 {
+		v.addf(path, "invalid port %q, it must be a number between 0 and 65535", port)
+	}
+}
 
-		if config.SEPP.Remote.TLS.CA == "" {
-			return fmt.Errorf("missing Remote TLS CA")
+func (v *validator) validateTLS(path string, files TLS) {
+	certOK := v.validateFile(path+".cert", files.Cert, certificateFile)
+	keyOK := v.validateFile(path+".key", files.Key, keyFile)
+	v.validateFile(path+".ca", files.CA, certificateFile)
+	if certOK && keyOK {
+		if _, err := tls.LoadX509KeyPair(files.Cert, files.Key); err != nil {
+			v.addf(path+".key", "does not match the certificate %s: %v", files.Cert, err)
 		}
 	}
-	return nil
 }
 
-func LoadConfiguration(filePath string) (*Config, error) {
-	configFile, err := os.Open(filePath)
+type fileKind int
+
+const (
+	certificateFile fileKind = iota
+	keyFile
+)
+
+// validateFile checks that filePath holds PEM certificates or a PEM
+// private key, and reports whether it does.
+func (v *validator) validateFile(path string, filePath string, kind fileKind) bool {
+	if filePath == "" {
+		v.addf(path, "missing")
+		return false
+	}
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		v.addf(path, "file not found")
+		return false
+	}
 	if err != nil {
-		return nil, err
+		v.addf(path, "failed to read file: %v", err)
+		return false
 	}
-	defer configFile.Close()
 
-	conf, err := ReadConfig(configFile)
-	if err != nil {
-		return nil, err
+	block, rest := pem.Decode(data)
+	if block == nil {
+		v.addf(path, "no PEM data found in %s", filePath)
+		return false
+	}
+	if kind == keyFile {
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			v.addf(path, "no PEM private key found in %s", filePath)
+			return false
+		}
+		return true
 	}
+	found := false
+	for ; block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			v.addf(path, "invalid certificate in %s: %v", filePath, err)
+			return false
+		}
+		found = true
+	}
+	if !found {
+		v.addf(path, "no PEM certificate found in %s", filePath)
+	}
+	return found
+}
 
-	return conf, nil
+func (v *validator) validateRoute(path string, route Route) {
+	if !strings.HasPrefix(route.ApiPrefix, "/") {
+		v.addf(path+".apiPrefix", "invalid API prefix %q, it must start with /", route.ApiPrefix)
+	}
+
+	apiRoot, err := url.Parse(route.ApiRoot)
+	if err != nil || (apiRoot.Scheme != "http" && apiRoot.Scheme != "https") || apiRoot.Host == "" {
+		v.addf(path+".apiRoot", "invalid apiRoot %q, it must be an http or https URL", route.ApiRoot)
+	} else if route.H2C && apiRoot.Scheme != "http" {
+		v.addf(path+".h2c", "h2c requires an http apiRoot, got %q", route.ApiRoot)
+	}
+}
+
+func (v *validator) validatePlmnID(path string, plmnID PlmnID) {
+	if !mccPattern.MatchString(plmnID.MCC) {
+		v.addf(path+".mcc", "invalid MCC %q, it must be 3 digits", plmnID.MCC)
+	}
+
+	if !mncPattern.MatchString(plmnID.MNC) {
+		v.addf(path+".mnc", "invalid MNC %q, it must be 2 or 3 digits", plmnID.MNC)
+	}
+}
+
+func (v *validator) validateRemote(path string, remote Remote) {
+	v.validatePlmnID(path+".plmnId", remote.PlmnID)
+
+	if remote.URL == "" {
+		v.addf(path+".url", "missing")
+	} else if remoteURL, err := url.Parse(remote.URL); err != nil || remoteURL.Scheme != "https" || remoteURL.Host == "" {
+		v.addf(path+".url", "invalid URL %q, it must be an https URL", remote.URL)
+	}
+
+	v.validateTLS(path+".tls", remote.TLS)
+}
+
+func (v *validator) validatePRINS(path string, prins PRINS) {
+	for i, cipherSuite := range prins.JweCipherSuites {
+		if !slices.Contains(jweCipherSuites, cipherSuite) {
+			v.addf(fmt.Sprintf("%s.jweCipherSuites.%d", path, i), "unsupported JWE cipher suite %s, supported values are %v", cipherSuite, jweCipherSuites)
+		}
+	}
+
+	for i, cipherSuite := range prins.JwsCipherSuites {
+		if !slices.Contains(jwsCipherSuites, cipherSuite) {
+			v.addf(fmt.Sprintf("%s.jwsCipherSuites.%d", path, i), "unsupported JWS cipher suite %s, supported values are %v", cipherSuite, jwsCipherSuites)
+		}
+	}
+
+	for i, ipxProvider := range prins.IpxProviders {
+		providerPath := fmt.Sprintf("%s.ipxProviders.%d", path, i)
+		if ipxProvider.ID == "" {
+			v.addf(providerPath+".id", "missing")
+		}
+
+		if len(ipxProvider.Certificates) == 0 {
+			v.addf(providerPath+".certificates", "missing")
+		}
+
+		for j, certificate := range ipxProvider.Certificates {
+			v.validateFile(fmt.Sprintf("%s.certificates.%d", providerPath, j), certificate, certificateFile)
+		}
+	}
+
+	for i, ieType := range prins.DataTypeEncPolicy {
+		if !slices.Contains(ieTypes, ieType) {
+			v.addf(fmt.Sprintf("%s.dataTypeEncPolicy.%d", path, i), "invalid IE type %s, supported values are %v", ieType, ieTypes)
+		}
+	}
+
+	for i, mapping := range prins.ApiIeMappingList {
+		mappingPath := fmt.Sprintf("%s.apiIeMappingList.%d", path, i)
+		if mapping.ApiSignature == "" {
+			v.addf(mappingPath+".apiSignature", "missing")
+		}
+
+		if mapping.ApiMethod == "" {
+			v.addf(mappingPath+".apiMethod", "missing")
+		}
+
+		for j, ie := range mapping.IeList {
+			iePath := fmt.Sprintf("%s.ieList.%d", mappingPath, j)
+			if !slices.Contains(ieLocations, ie.IeLoc) {
+				v.addf(iePath+".ieLoc", "invalid IE location %s, supported values are %v", ie.IeLoc, ieLocations)
+			}
+
+			if !slices.Contains(ieTypes, ie.IeType) {
+				v.addf(iePath+".ieType", "invalid IE type %s, supported values are %v", ie.IeType, ieTypes)
+			}
+
+			if ie.ReqIe == "" && ie.RspIe == "" {
+				v.addf(iePath, "missing request or response IE")
+			}
+		}
+	}
+}
+
+func LoadConfiguration(filePath string) (*Config, error) {
+	return Load(filePath, nil, nil, log.Default())
 }
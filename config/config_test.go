@@ -1,7 +1,10 @@
 package config_test
 
 import (
+	"errors"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/dot-5g/sepp/config"
@@ -19,6 +22,26 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("Failed to read config: %s", err)
 	}
 
+	if len(conf.SEPP.SecurityCapabilities) != 1 || conf.SEPP.SecurityCapabilities[0] != "TLS" {
+		t.Errorf("Expected security capabilities '[TLS]', got '%v'", conf.SEPP.SecurityCapabilities)
+	}
+
+	if len(conf.SEPP.PRINS.DataTypeEncPolicy) != 2 || conf.SEPP.PRINS.DataTypeEncPolicy[0] != "UEID" {
+		t.Errorf("Expected PRINS data type encryption policy '[UEID AUTHORIZATION_TOKEN]', got '%v'", conf.SEPP.PRINS.DataTypeEncPolicy)
+	}
+
+	if len(conf.SEPP.PRINS.ApiIeMappingList) != 1 || len(conf.SEPP.PRINS.ApiIeMappingList[0].IeList) != 2 {
+		t.Errorf("Expected one PRINS API IE mapping with two IEs, got '%v'", conf.SEPP.PRINS.ApiIeMappingList)
+	}
+
+	if len(conf.SEPP.PRINS.JweCipherSuites) != 1 || conf.SEPP.PRINS.JweCipherSuites[0] != "A128GCM" {
+		t.Errorf("Expected PRINS JWE cipher suites '[A128GCM]', got '%v'", conf.SEPP.PRINS.JweCipherSuites)
+	}
+
+	if len(conf.SEPP.PRINS.IpxProviders) != 1 || conf.SEPP.PRINS.IpxProviders[0].ID != "ipx.example.com" {
+		t.Errorf("Expected one PRINS IPX provider 'ipx.example.com', got '%v'", conf.SEPP.PRINS.IpxProviders)
+	}
+
 	if conf.SEPP.Local.N32.FQDN != "local-sepp.example.com" {
 		t.Errorf("Expected FQDN 'local-sepp.example.com', got '%s'", conf.SEPP.Local.N32.FQDN)
 	}
@@ -31,16 +54,20 @@ func TestConfig(t *testing.T) {
 		t.Errorf("Expected port '1234', got '%s'", conf.SEPP.Local.N32.Port)
 	}
 
-	if conf.SEPP.Local.N32.TLS.Cert != "/etc/sepp/certs/n32Server.crt" {
-		t.Errorf("Expected TLS cert '/etc/sepp/certs/n32Server.crt', got '%s'", conf.SEPP.Local.N32.TLS.Cert)
+	if conf.SEPP.Local.N32.TLS.Cert != "testdata/sepp.crt" {
+		t.Errorf("Expected TLS cert 'testdata/sepp.crt', got '%s'", conf.SEPP.Local.N32.TLS.Cert)
+	}
+
+	if conf.SEPP.Local.N32.TLS.Key != "testdata/sepp.key" {
+		t.Errorf("Expected TLS key 'testdata/sepp.key', got '%s'", conf.SEPP.Local.N32.TLS.Key)
 	}
 
-	if conf.SEPP.Local.N32.TLS.Key != "/etc/sepp/certs/n32Server.key" {
-		t.Errorf("Expected TLS key '/etc/sepp/certs/n32Server.key', got '%s'", conf.SEPP.Local.N32.TLS.Key)
+	if conf.SEPP.Local.N32.TLS.CA != "testdata/ca.crt" {
+		t.Errorf("Expected TLS CA 'testdata/ca.crt', got '%s'", conf.SEPP.Local.N32.TLS.CA)
 	}
 
-	if conf.SEPP.Local.N32.TLS.CA != "/etc/sepp/certs/ca.crt" {
-		t.Errorf("Expected TLS CA '/etc/sepp/certs/ca.crt', got '%s'", conf.SEPP.Local.N32.TLS.CA)
+	if conf.SEPP.Local.SBI.FQDN != "local-sbi.example.com" {
+		t.Errorf("Expected FQDN 'local-sbi.example.com', got '%s'", conf.SEPP.Local.SBI.FQDN)
 	}
 
 	if conf.SEPP.Local.SBI.Host != "localhost" {
@@ -51,20 +78,143 @@ func TestConfig(t *testing.T) {
 		t.Errorf("Expected port '1235', got '%s'", conf.SEPP.Local.SBI.Port)
 	}
 
-	if conf.SEPP.Local.SBI.TLS.Cert != "/etc/sepp/certs/sbiServer.crt" {
-		t.Errorf("Expected TLS cert '/etc/sepp/certs/sbiServer.crt', got '%s'", conf.SEPP.Local.SBI.TLS.Cert)
+	if conf.SEPP.Local.SBI.TLS.Cert != "testdata/sepp.crt" {
+		t.Errorf("Expected TLS cert 'testdata/sepp.crt', got '%s'", conf.SEPP.Local.SBI.TLS.Cert)
+	}
+
+	if conf.SEPP.Local.SBI.TLS.Key != "testdata/sepp.key" {
+		t.Errorf("Expected TLS key 'testdata/sepp.key', got '%s'", conf.SEPP.Local.SBI.TLS.Key)
+	}
+
+	if conf.SEPP.Local.SBI.TLS.CA != "testdata/ca.crt" {
+		t.Errorf("Expected TLS CA 'testdata/ca.crt', got '%s'", conf.SEPP.Local.SBI.TLS.CA)
+	}
+
+	if len(conf.SEPP.Local.Routes) != 1 || conf.SEPP.Local.Routes[0].ApiPrefix != "/nudm-sdm/" || conf.SEPP.Local.Routes[0].ApiRoot != "https://nudm.example.com:8443" {
+		t.Errorf("Expected one route from '/nudm-sdm/' to 'https://nudm.example.com:8443', got '%v'", conf.SEPP.Local.Routes)
+	}
+
+	if len(conf.SEPP.Remotes) != 1 {
+		t.Fatalf("Expected one remote, got %d", len(conf.SEPP.Remotes))
+	}
+
+	if conf.SEPP.Remotes[0].PlmnID.MCC != "001" || conf.SEPP.Remotes[0].PlmnID.MNC != "01" {
+		t.Errorf("Expected remote PLMN ID '001-01', got '%v'", conf.SEPP.Remotes[0].PlmnID)
+	}
+
+	if conf.SEPP.Remotes[0].URL != "https://remote-sepp.example.com" {
+		t.Errorf("Expected URL 'https://remote-sepp.example.com', got '%s'", conf.SEPP.Remotes[0].URL)
+	}
+
+}
+
+func TestGivenDuplicateRemotePlmnIdWhenReadConfigThenErrorIsReturned(t *testing.T) {
+	data, err := os.ReadFile("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %s", err)
+	}
+	remote := `    - plmnId:
+        mcc: "001"
+        mnc: "01"
+      url: "https://other-sepp.example.com"
+      tls:
+        cert: "testdata/sepp.crt"
+        key: "testdata/sepp.key"
+        ca: "testdata/ca.crt"
+`
+
+	_, err = config.ReadConfig(strings.NewReader(string(data) + remote))
+
+	if err == nil || !strings.Contains(err.Error(), "sepp.remotes.1.plmnId: duplicate PLMN ID 001-01") {
+		t.Errorf("Expected duplicate PLMN ID error, got %v", err)
+	}
+}
+
+func TestGivenInvalidLocalPlmnIdWhenReadConfigThenErrorIsReturned(t *testing.T) {
+	data, err := os.ReadFile("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %s", err)
+	}
+	invalid := strings.Replace(string(data), "  local:\n", "  local:\n    plmnId:\n      mcc: \"1\"\n      mnc: \"01\"\n", 1)
+
+	_, err = config.ReadConfig(strings.NewReader(invalid))
+
+	if err == nil || !strings.Contains(err.Error(), `sepp.local.plmnId.mcc: invalid MCC "1"`) {
+		t.Errorf("Expected invalid MCC error, got %v", err)
 	}
+}
 
-	if conf.SEPP.Local.SBI.TLS.Key != "/etc/sepp/certs/sbiServer.key" {
-		t.Errorf("Expected TLS key '/etc/sepp/certs/sbiServer.key', got '%s'", conf.SEPP.Local.SBI.TLS.Key)
+func TestGivenRouteWithoutSchemeWhenReadConfigThenErrorIsReturned(t *testing.T) {
+	data, err := os.ReadFile("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %s", err)
 	}
+	invalid := strings.Replace(string(data), "https://nudm.example.com:8443", "nudm.example.com:8443", 1)
+
+	_, err = config.ReadConfig(strings.NewReader(invalid))
 
-	if conf.SEPP.Local.SBI.TLS.CA != "/etc/sepp/certs/ca.crt" {
-		t.Errorf("Expected TLS CA '/etc/sepp/certs/ca.crt', got '%s'", conf.SEPP.Local.SBI.TLS.CA)
+	if err == nil || !strings.Contains(err.Error(), "sepp.local.routes.0.apiRoot: invalid apiRoot") {
+		t.Errorf("Expected invalid route error, got %v", err)
 	}
+}
 
-	if conf.SEPP.Remote.URL != "https://remote-sepp.example.com" {
-		t.Errorf("Expected URL 'https://remote-sepp.example.com', got '%s'", conf.SEPP.Remote.URL)
+func TestGivenH2cRouteWithHttpsApiRootWhenReadConfigThenErrorIsReturned(t *testing.T) {
+	data, err := os.ReadFile("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %s", err)
 	}
+	invalid := strings.Replace(string(data), `apiRoot: "https://nudm.example.com:8443"`, `apiRoot: "https://nudm.example.com:8443"
+        h2c: true`, 1)
+
+	_, err = config.ReadConfig(strings.NewReader(invalid))
+
+	if err == nil || !strings.Contains(err.Error(), "sepp.local.routes.0.h2c: h2c requires an http apiRoot") {
+		t.Errorf("Expected h2c route error, got %v", err)
+	}
+}
+
+func TestGivenSeveralViolationsWhenReadConfigThenAllAreReturnedWithTheirPaths(t *testing.T) {
+	data, err := os.ReadFile("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %s", err)
+	}
+	invalid := strings.Replace(string(data), `port: "1235"`, `port: "70000"`, 1)
+	invalid = strings.Replace(invalid, "https://remote-sepp.example.com", "http://remote-sepp.example.com", 1)
+	invalid = strings.Replace(invalid, `cert: "testdata/sepp.crt"`, `cert: "testdata/missing.crt"`, 2)
+	invalid = strings.Replace(invalid, "cert: \"testdata/missing.crt\"\n", "cert: \"testdata/sepp.crt\"\n", 1)
+	invalid = strings.Replace(invalid, "    routes:", "    unknown: true\n    routes:", 1)
+
+	_, err = config.ReadConfig(strings.NewReader(invalid))
 
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	expected := []config.FieldError{
+		{Path: "sepp.local.unknown", Message: "unknown field"},
+		{Path: "sepp.local.sbi.port", Message: `invalid port "70000", it must be a number between 0 and 65535`},
+		{Path: "sepp.local.sbi.tls.cert", Message: "file not found"},
+		{Path: "sepp.remotes.0.url", Message: `invalid URL "http://remote-sepp.example.com", it must be an https URL`},
+	}
+	if !slices.Equal(validationErr.Errors, expected) {
+		t.Errorf("Expected errors %v, got %v", expected, validationErr.Errors)
+	}
+}
+
+func TestGivenKeyInsteadOfCertificateWhenValidateThenErrorIsReturned(t *testing.T) {
+	file, err := os.Open("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to open config file: %s", err)
+	}
+	conf, err := config.ReadConfig(file)
+	if err != nil {
+		t.Fatalf("Failed to read config: %s", err)
+	}
+	conf.SEPP.Local.N32.TLS.CA = "testdata/sepp.key"
+
+	err = conf.Validate()
+
+	if err == nil || !strings.Contains(err.Error(), "sepp.local.n32.tls.ca: no PEM certificate found in testdata/sepp.key") {
+		t.Errorf("Expected no PEM certificate error, got %v", err)
+	}
 }
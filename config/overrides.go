@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix starts the name of every environment variable overriding a
+// field, as the root YAML key does.
+const EnvPrefix = "SEPP_"
+
+// Overrides are path=value assignments given on the command line, such
+// as sepp.local.n32.port=1234. It can be used as a repeated flag.
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *Overrides) Set(assignment string) error {
+	if _, _, ok := strings.Cut(assignment, "="); !ok {
+		return fmt.Errorf("invalid override %q, expected path=value", assignment)
+	}
+	*o = append(*o, assignment)
+	return nil
+}
+
+// Load reads the configuration from filePath, then applies the
+// environment variables of environ and finally overrides, so that each
+// source takes precedence over the previous one. The result is
+// validated once every source is applied. Environment variables naming
+// no field, such as those Kubernetes sets for a Service named sepp, are
+// reported to logger and ignored.
+func Load(filePath string, environ []string, overrides Overrides, logger *log.Logger) (*Config, error) {
+	configFile, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer configFile.Close()
+	data, err := io.ReadAll(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config data: %w", err)
+	}
+	var v validator
+	config, err := decode(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := config.ApplyEnv(environ)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range ignored {
+		logger.Printf("config - ignoring environment variable %s, it names no config field", name)
+	}
+	for _, assignment := range overrides {
+		path, value, _ := strings.Cut(assignment, "=")
+		if err := config.Set(path, value); err != nil {
+			return nil, err
+		}
+	}
+	v.validateConfig(config)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Set assigns value to the field at path, the dotted list of its YAML
+// keys and list indexes such as sepp.remotes.0.url. An index equal to the
+// length of a list appends an element. Lists of strings are given as
+// comma separated values.
+func (config *Config) Set(path string, value string) error {
+	if err := set(reflect.ValueOf(config).Elem(), strings.Split(path, "."), value); err != nil {
+		return fmt.Errorf("invalid override of %s: %w", path, err)
+	}
+	return nil
+}
+
+// ApplyEnv sets the fields named by the variables of environ starting
+// with EnvPrefix. A variable is named after the path of its field in
+// upper snake case: SEPP_LOCAL_N32_PORT sets sepp.local.n32.port and
+// SEPP_REMOTES_0_TLS_CERT sets sepp.remotes.0.tls.cert. Variables naming
+// no field are skipped and returned.
+func (config *Config) ApplyEnv(environ []string) ([]string, error) {
+	type assignment struct {
+		name  string
+		path  []string
+		value string
+	}
+	var assignments []assignment
+	var ignored []string
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		path, err := envPath(reflect.TypeOf(*config), name)
+		if err != nil {
+			ignored = append(ignored, name)
+			continue
+		}
+		assignments = append(assignments, assignment{name: name, path: path, value: value})
+	}
+	// List elements are appended in the order of their indexes.
+	sort.Slice(assignments, func(i, j int) bool {
+		return comparePaths(assignments[i].path, assignments[j].path) < 0
+	})
+	for _, assignment := range assignments {
+		if err := config.Set(strings.Join(assignment.path, "."), assignment.value); err != nil {
+			return nil, fmt.Errorf("invalid environment variable %s: %w", assignment.name, err)
+		}
+	}
+	return ignored, nil
+}
+
+// comparePaths orders paths key by key, list indexes by their value.
+func comparePaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		indexA, errA := strconv.Atoi(a[i])
+		indexB, errB := strconv.Atoi(b[i])
+		if errA == nil && errB == nil {
+			return indexA - indexB
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return len(a) - len(b)
+}
+
+func set(v reflect.Value, path []string, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		if len(path) > 0 {
+			return fmt.Errorf("unknown field %s", path[0])
+		}
+		v.SetString(value)
+		return nil
+	case reflect.Bool:
+		if len(path) > 0 {
+			return fmt.Errorf("unknown field %s", path[0])
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String && len(path) == 0 {
+			v.Set(reflect.ValueOf(splitList(value)))
+			return nil
+		}
+		if len(path) == 0 {
+			return fmt.Errorf("missing list index")
+		}
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 || index > v.Len() {
+			return fmt.Errorf("invalid list index %s, the list has %d elements", path[0], v.Len())
+		}
+		if index == v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return set(v.Index(index), path[1:], value)
+	case reflect.Struct:
+		if len(path) == 0 {
+			return fmt.Errorf("missing field of %s", v.Type().Name())
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if yamlKey(v.Type().Field(i)) == path[0] {
+				return set(v.Field(i), path[1:], value)
+			}
+		}
+		return fmt.Errorf("unknown field %s", path[0])
+	}
+	return fmt.Errorf("unsupported field type %s", v.Type())
+}
+
+// envPath converts the name of an environment variable to the path of
+// the field of t it names, matching the longest field name at each level.
+func envPath(t reflect.Type, name string) ([]string, error) {
+	var path []string
+	rest := name
+	for rest != "" {
+		switch t.Kind() {
+		case reflect.Struct:
+			match := -1
+			for i := 0; i < t.NumField(); i++ {
+				candidate := envName(yamlKey(t.Field(i)))
+				if (rest == candidate || strings.HasPrefix(rest, candidate+"_")) && (match < 0 || len(candidate) > len(envName(yamlKey(t.Field(match))))) {
+					match = i
+				}
+			}
+			if match < 0 {
+				return nil, fmt.Errorf("unknown field %s", rest)
+			}
+			field := t.Field(match)
+			path = append(path, yamlKey(field))
+			rest = strings.TrimPrefix(strings.TrimPrefix(rest, envName(yamlKey(field))), "_")
+			t = field.Type
+		case reflect.Slice:
+			index, remaining, _ := strings.Cut(rest, "_")
+			if _, err := strconv.Atoi(index); err != nil {
+				return nil, fmt.Errorf("invalid list index %s", index)
+			}
+			path = append(path, index)
+			rest = remaining
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("unknown field %s", rest)
+		}
+	}
+	return path, nil
+}
+
+func yamlKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return key
+}
+
+// envName converts a YAML key to upper snake case: apiPrefix becomes
+// API_PREFIX.
+func envName(key string) string {
+	var name strings.Builder
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
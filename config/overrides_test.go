@@ -0,0 +1,102 @@
+package config_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/dot-5g/sepp/config"
+)
+
+func TestGivenEnvAndFlagOverridesWhenLoadThenFlagsTakePrecedence(t *testing.T) {
+	environ := []string{"SEPP_LOCAL_N32_PORT=2000", "SEPP_LOCAL_SBI_PORT=2001", "HOME=/root"}
+	overrides := config.Overrides{"sepp.local.n32.port=3000"}
+
+	conf, err := config.Load("config_test.yaml", environ, overrides, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if conf.SEPP.Local.N32.Port != "3000" {
+		t.Errorf("Expected N32 port from flag '3000', got '%s'", conf.SEPP.Local.N32.Port)
+	}
+	if conf.SEPP.Local.SBI.Port != "2001" {
+		t.Errorf("Expected SBI port from environment '2001', got '%s'", conf.SEPP.Local.SBI.Port)
+	}
+	if conf.SEPP.Local.N32.Host != "localhost" {
+		t.Errorf("Expected N32 host from file 'localhost', got '%s'", conf.SEPP.Local.N32.Host)
+	}
+}
+
+func TestGivenEnvForNewRemoteWhenLoadThenRemoteIsAppended(t *testing.T) {
+	environ := []string{
+		"SEPP_REMOTES_1_TLS_CA=testdata/ca.crt",
+		"SEPP_REMOTES_1_URL=https://other-sepp.example.com",
+		"SEPP_REMOTES_1_PLMN_ID_MCC=002",
+		"SEPP_REMOTES_1_PLMN_ID_MNC=02",
+		"SEPP_REMOTES_1_TLS_CERT=testdata/sepp.crt",
+		"SEPP_REMOTES_1_TLS_KEY=testdata/sepp.key",
+		"SEPP_LOCAL_ROUTES_0_API_PREFIX=/nausf-auth/",
+		"SEPP_SECURITY_CAPABILITIES=PRINS, TLS",
+	}
+
+	conf, err := config.Load("config_test.yaml", environ, nil, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(conf.SEPP.Remotes) != 2 || conf.SEPP.Remotes[1].URL != "https://other-sepp.example.com" || conf.SEPP.Remotes[1].PlmnID.MNC != "02" {
+		t.Errorf("Expected a second remote 'https://other-sepp.example.com', got '%v'", conf.SEPP.Remotes)
+	}
+	if conf.SEPP.Local.Routes[0].ApiPrefix != "/nausf-auth/" {
+		t.Errorf("Expected route prefix '/nausf-auth/', got '%s'", conf.SEPP.Local.Routes[0].ApiPrefix)
+	}
+	if len(conf.SEPP.SecurityCapabilities) != 2 || conf.SEPP.SecurityCapabilities[0] != "PRINS" || conf.SEPP.SecurityCapabilities[1] != "TLS" {
+		t.Errorf("Expected security capabilities '[PRINS TLS]', got '%v'", conf.SEPP.SecurityCapabilities)
+	}
+}
+
+func TestGivenUnknownEnvWhenLoadThenItIsLoggedAndIgnored(t *testing.T) {
+	var logs bytes.Buffer
+	environ := []string{"SEPP_SERVICE_HOST=10.0.0.1", "SEPP_PORT_1231_TCP=tcp://10.0.0.1:1231", "SEPP_LOCAL_N32_PORT=2000"}
+
+	conf, err := config.Load("config_test.yaml", environ, nil, log.New(&logs, "", 0))
+
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if conf.SEPP.Local.N32.Port != "2000" {
+		t.Errorf("Expected N32 port from environment '2000', got '%s'", conf.SEPP.Local.N32.Port)
+	}
+	if !strings.Contains(logs.String(), "SEPP_SERVICE_HOST") || !strings.Contains(logs.String(), "SEPP_PORT_1231_TCP") {
+		t.Errorf("Expected the unknown variables to be logged, got %q", logs.String())
+	}
+}
+
+func TestGivenUnknownFieldInSetWhenLoadThenErrorIsReturned(t *testing.T) {
+	_, err := config.Load("config_test.yaml", nil, config.Overrides{"sepp.local.n32.prot=2000"}, log.New(io.Discard, "", 0))
+
+	if err == nil || !strings.Contains(err.Error(), "unknown field prot") {
+		t.Errorf("Expected unknown field error, got %v", err)
+	}
+}
+
+func TestGivenOutOfRangeIndexWhenSetThenErrorIsReturned(t *testing.T) {
+	var conf config.Config
+
+	err := conf.Set("sepp.remotes.1.url", "https://remote-sepp.example.com")
+
+	if err == nil || !strings.Contains(err.Error(), "invalid list index") {
+		t.Errorf("Expected invalid list index error, got %v", err)
+	}
+}
+
+func TestGivenOverrideBreakingValidationWhenLoadThenErrorIsReturned(t *testing.T) {
+	_, err := config.Load("config_test.yaml", nil, config.Overrides{"sepp.remotes.0.plmnId.mcc=1"}, log.New(io.Discard, "", 0))
+
+	if err == nil || !strings.Contains(err.Error(), "sepp.remotes.0.plmnId.mcc: invalid MCC") {
+		t.Errorf("Expected invalid MCC error, got %v", err)
+	}
+}
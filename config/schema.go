@@ -0,0 +1,94 @@
+package config
+
+import "reflect"
+
+// SchemaURI identifies the JSON Schema dialect returned by Schema.
+const SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// requiredFields lists the keys an object must have, by YAML path, list
+// elements being matched by *.
+var requiredFields = map[string][]string{
+	"":                                       {"sepp"},
+	"sepp":                                   {"securityCapabilities", "local"},
+	"sepp.local":                             {"n32", "sbi"},
+	"sepp.local.plmnId":                      {"mcc", "mnc"},
+	"sepp.local.n32":                         {"fqdn", "host", "port", "tls"},
+	"sepp.local.n32.tls":                     {"cert", "key", "ca"},
+	"sepp.local.sbi":                         {"host", "port", "tls"},
+	"sepp.local.sbi.tls":                     {"cert", "key", "ca"},
+	"sepp.local.routes.*":                    {"apiPrefix", "apiRoot"},
+	"sepp.remotes.*":                         {"plmnId", "url", "tls"},
+	"sepp.remotes.*.plmnId":                  {"mcc", "mnc"},
+	"sepp.remotes.*.tls":                     {"cert", "key", "ca"},
+	"sepp.prins.ipxProviders.*":              {"id", "certificates"},
+	"sepp.prins.apiIeMappingList.*":          {"apiSignature", "apiMethod"},
+	"sepp.prins.apiIeMappingList.*.ieList.*": {"ieLoc", "ieType"},
+}
+
+var portSchema = map[string]any{
+	"type":    []string{"string", "integer"},
+	"pattern": "^[0-9]+$",
+	"minimum": 0,
+	"maximum": 65535,
+}
+
+// fieldSchemas refines the schema of the fields checked by validateConfig
+// beyond their type, by YAML path.
+var fieldSchemas = map[string]map[string]any{
+	"sepp.securityCapabilities":                     {"minItems": 1, "uniqueItems": true},
+	"sepp.securityCapabilities.*":                   {"enum": securityCapabilities},
+	"sepp.prins.jweCipherSuites.*":                  {"enum": jweCipherSuites},
+	"sepp.prins.jwsCipherSuites.*":                  {"enum": jwsCipherSuites},
+	"sepp.prins.dataTypeEncPolicy.*":                {"enum": ieTypes},
+	"sepp.prins.ipxProviders.*.certificates":        {"minItems": 1},
+	"sepp.prins.apiIeMappingList.*.ieList.*.ieLoc":  {"enum": ieLocations},
+	"sepp.prins.apiIeMappingList.*.ieList.*.ieType": {"enum": ieTypes},
+	"sepp.local.plmnId.mcc":                         {"pattern": mccPattern.String()},
+	"sepp.local.plmnId.mnc":                         {"pattern": mncPattern.String()},
+	"sepp.local.n32.port":                           portSchema,
+	"sepp.local.sbi.port":                           portSchema,
+	"sepp.local.routes.*.apiPrefix":                 {"pattern": "^/"},
+	"sepp.local.routes.*.apiRoot":                   {"format": "uri", "pattern": "^https?://"},
+	"sepp.remotes.*.plmnId.mcc":                     {"pattern": mccPattern.String()},
+	"sepp.remotes.*.plmnId.mnc":                     {"pattern": mncPattern.String()},
+	"sepp.remotes.*.url":                            {"format": "uri", "pattern": "^https://"},
+}
+
+// Schema returns the JSON Schema of the configuration file, for editors
+// to complete and check it. Checks needing the file system, such as the
+// existence of certificates, are left to Validate.
+func Schema() map[string]any {
+	schema := schemaOf("", reflect.TypeOf(Config{}))
+	schema["$schema"] = SchemaURI
+	schema["title"] = "SEPP configuration"
+	return schema
+}
+
+func schemaOf(path string, t reflect.Type) map[string]any {
+	schema := make(map[string]any)
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]any, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			key := yamlKey(t.Field(i))
+			properties[key] = schemaOf(joinPath(path, key), t.Field(i).Type)
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		if required, ok := requiredFields[path]; ok {
+			schema["required"] = required
+		}
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = schemaOf(joinPath(path, "*"), t.Elem())
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	}
+	for keyword, value := range fieldSchemas[path] {
+		schema[keyword] = value
+	}
+	return schema
+}
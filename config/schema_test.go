@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/dot-5g/sepp/config"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGivenTestConfigWhenLookingUpItsKeysInSchemaThenEveryKeyIsDescribed(t *testing.T) {
+	data, err := os.ReadFile("config_test.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read config file: %s", err)
+	}
+	var document any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		t.Fatalf("Failed to unmarshal config: %s", err)
+	}
+
+	checkDescribed(t, "", config.Schema(), document)
+}
+
+func checkDescribed(t *testing.T, path string, schema map[string]any, node any) {
+	switch node := node.(type) {
+	case map[any]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for key, value := range node {
+			property, ok := properties[fmt.Sprint(key)].(map[string]any)
+			if !ok {
+				t.Errorf("Expected %s.%v to be described by the schema", path, key)
+				continue
+			}
+			checkDescribed(t, fmt.Sprintf("%s.%v", path, key), property, value)
+		}
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			t.Errorf("Expected %s to be described as an array", path)
+			return
+		}
+		for i, item := range node {
+			checkDescribed(t, fmt.Sprintf("%s.%d", path, i), items, item)
+		}
+	}
+}
+
+func TestGivenSchemaWhenReadingSecurityCapabilitiesThenSupportedValuesAreEnumerated(t *testing.T) {
+	schema := config.Schema()
+
+	sepp := schema["properties"].(map[string]any)["sepp"].(map[string]any)
+	capabilities := sepp["properties"].(map[string]any)["securityCapabilities"].(map[string]any)
+	enum, _ := capabilities["items"].(map[string]any)["enum"].([]string)
+
+	if !slices.Equal(enum, []string{"TLS", "PRINS", "NONE"}) {
+		t.Errorf("Expected security capabilities enum '[TLS PRINS NONE]', got '%v'", enum)
+	}
+	if sepp["additionalProperties"] != false {
+		t.Errorf("Expected unknown keys to be rejected, got additionalProperties '%v'", sepp["additionalProperties"])
+	}
+}
@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 
 	"github.com/docker/docker/api/types"
@@ -106,3 +107,24 @@ func RemoveNetwork(networkName string) error {
 	log.Printf("docker - network %s removed successfully", networkName)
 	return nil
 }
+
+// ContainerLogs returns what the container wrote to its standard output
+// and error so far.
+func ContainerLogs(containerName string) (string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+
+	logs, err := cli.ContainerLogs(context.Background(), containerName, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs of container %s: %v", containerName, err)
+	}
+	defer logs.Close()
+
+	output, err := io.ReadAll(logs)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs of container %s: %v", containerName, err)
+	}
+	return string(output), nil
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -54,12 +55,12 @@ func Cleanup(seppAID string, seppBID string, networkName string) {
 	}
 }
 
-func waitForService(client *http.Client, url string, maxRetries int) error {
+func waitForService(client *http.Client, url string, expectedStatusCode int, maxRetries int) error {
 	for i := 0; i < maxRetries; i++ {
 		resp, err := client.Get(url)
 		if err == nil {
 			resp.Body.Close()
-			if resp.StatusCode == http.StatusOK {
+			if resp.StatusCode == expectedStatusCode {
 				log.Printf("Service available at %s", url)
 				return nil
 			}
@@ -106,7 +107,18 @@ func TestEndToEnd(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create client: %v", err)
 	}
-	if err := waitForService(client, PLMNASBIFQDN, 10); err != nil {
+	// PLMN B has no NF serving the root path, so its SEPP answers 404
+	// once the request made it through both SEPPs.
+	if err := waitForService(client, PLMNASBIFQDN, http.StatusNotFound, 10); err != nil {
 		t.Fatalf("Failed to connect to SEPP in PLMN A: %v", err)
 	}
+	// The SEPP of PLMN A would answer the same if it forwarded the
+	// request to itself, only the logs of PLMN B tell that it got there.
+	logs, err := docker.ContainerLogs(PLMNBSEPPHostname)
+	if err != nil {
+		t.Fatalf("Failed to read logs of SEPP in PLMN B: %v", err)
+	}
+	if !strings.Contains(logs, "SBI server - no local NF for GET /") {
+		t.Errorf("Expected the request to reach the SEPP in PLMN B, got logs:\n%s", logs)
+	}
 }
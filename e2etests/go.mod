@@ -5,6 +5,7 @@ go 1.21.6
 require (
 	github.com/docker/docker v25.0.2+incompatible
 	github.com/docker/go-connections v0.5.0
+	github.com/dot-5g/sepp v0.0.0
 )
 
 require (
@@ -31,3 +32,5 @@ require (
 	golang.org/x/time v0.5.0 // indirect
 	gotest.tools/v3 v3.5.1 // indirect
 )
+
+replace github.com/dot-5g/sepp => ../
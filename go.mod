@@ -2,4 +2,11 @@ module github.com/dot-5g/sepp
 
 go 1.21.6
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/go-jose/go-jose/v4 v4.0.4
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require golang.org/x/text v0.21.0 // indirect
@@ -0,0 +1,44 @@
+// Package certs loads the certificates the SEPP authenticates with and
+// the CAs it trusts.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// ErrCertLoad is returned when a certificate or its private key
+	// cannot be read or parsed, or when they do not match.
+	ErrCertLoad = errors.New("failed to load certificate")
+	// ErrInvalidCA is returned when a CA file cannot be read or holds no
+	// PEM encoded certificate.
+	ErrInvalidCA = errors.New("invalid CA certificate")
+)
+
+// LoadKeyPair loads the PEM encoded certificate and private key at the
+// given paths.
+func LoadKeyPair(certPath, keyPath string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w %s: %w", ErrCertLoad, certPath, err)
+	}
+	return cert, nil
+}
+
+// LoadCAPool returns a pool holding the PEM encoded certificates at
+// caPath.
+func LoadCAPool(caPath string) (*x509.CertPool, error) {
+	caCert, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidCA, caPath, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("%w %s: no PEM encoded certificate found", ErrInvalidCA, caPath)
+	}
+	return pool, nil
+}
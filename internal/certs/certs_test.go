@@ -0,0 +1,41 @@
+package certs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/certs"
+)
+
+func TestGivenFileWithoutPEMWhenLoadCAPoolThenErrInvalidCAIsReturned(t *testing.T) {
+	caPath := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caPath, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	_, err := certs.LoadCAPool(caPath)
+
+	if !errors.Is(err, certs.ErrInvalidCA) {
+		t.Errorf("Expected ErrInvalidCA, got %v", err)
+	}
+}
+
+func TestGivenMissingFileWhenLoadCAPoolThenErrInvalidCAIsReturned(t *testing.T) {
+	_, err := certs.LoadCAPool(filepath.Join(t.TempDir(), "missing.crt"))
+
+	if !errors.Is(err, certs.ErrInvalidCA) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrInvalidCA wrapping the file error, got %v", err)
+	}
+}
+
+func TestGivenMissingKeyWhenLoadKeyPairThenErrCertLoadIsReturned(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := certs.LoadKeyPair(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+
+	if !errors.Is(err, certs.ErrCertLoad) {
+		t.Errorf("Expected ErrCertLoad, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// material is a key pair and the CAs it is used with, loaded together.
+type material struct {
+	cert   *tls.Certificate
+	caPool *x509.CertPool
+}
+
+// fileState identifies the version of a file that was last loaded.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Store serves a key pair and a CA pool loaded from files. They can be
+// reloaded at any time: connections established afterwards use the new
+// material while a file that fails to load keeps the previous one in use.
+type Store struct {
+	certPath string
+	keyPath  string
+	caPath   string
+	logger   *log.Logger
+
+	material atomic.Pointer[material]
+	mu       sync.Mutex
+	loaded   [3]fileState
+}
+
+// NewStore loads the key pair and CA pool at the given paths.
+func NewStore(certPath, keyPath, caPath string, logger *log.Logger) (*Store, error) {
+	s := &Store{certPath: certPath, keyPath: keyPath, caPath: caPath, logger: logger}
+	s.loaded = s.stat()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	caPool, err := LoadCAPool(s.caPath)
+	if err != nil {
+		return err
+	}
+	cert, err := LoadKeyPair(s.certPath, s.keyPath)
+	if err != nil {
+		return err
+	}
+	s.material.Store(&material{cert: &cert, caPool: caPool})
+	return nil
+}
+
+func (s *Store) stat() [3]fileState {
+	var states [3]fileState
+	for i, path := range []string{s.certPath, s.keyPath, s.caPath} {
+		if info, err := os.Stat(path); err == nil {
+			states[i] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return states
+}
+
+// Reload loads the files again. On failure the previous material stays
+// in use and the error is logged and returned.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = s.stat()
+	return s.reload()
+}
+
+// ReloadIfModified reloads the files if any of them changed since they
+// were last loaded. A file that fails to load is only retried once it
+// changes again.
+func (s *Store) ReloadIfModified() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := s.stat()
+	if states == s.loaded {
+		return nil
+	}
+	s.loaded = states
+	return s.reload()
+}
+
+func (s *Store) reload() error {
+	if err := s.load(); err != nil {
+		s.logger.Printf("certificates - failed to reload %s, keeping the previous one: %v", s.certPath, err)
+		return err
+	}
+	s.logger.Printf("certificates - reloaded %s", s.certPath)
+	return nil
+}
+
+// Certificate returns the key pair in use.
+func (s *Store) Certificate() *tls.Certificate {
+	return s.material.Load().cert
+}
+
+// CAPool returns the CA pool in use.
+func (s *Store) CAPool() *x509.CertPool {
+	return s.material.Load().caPool
+}
+
+// ServerTLSConfig returns a server configuration presenting the key pair
+// in use and requiring client certificates issued by the CAs in use.
+func (s *Store) ServerTLSConfig() *tls.Config {
+	config := &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.Certificate(), nil
+		},
+	}
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		// The configuration is cloned at handshake time so that
+		// settings added by HTTP/2, such as NextProtos, are kept.
+		current := config.Clone()
+		current.GetConfigForClient = nil
+		current.ClientCAs = s.CAPool()
+		return current, nil
+	}
+	return config
+}
+
+// ClientTLSConfig returns a client configuration presenting the key pair
+// in use and verifying that the server holds a certificate for host, a
+// DNS name or an IP address, issued by the CAs in use.
+func (s *Store) ClientTLSConfig(host string) *tls.Config {
+	return &tls.Config{
+		ServerName: host,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.Certificate(), nil
+		},
+		// RootCAs cannot change once the configuration is in use, the
+		// server chain is verified by VerifyConnection instead. host is
+		// captured as the ServerName of the state is empty for IP
+		// addresses.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return s.verifyServer(state, host)
+		},
+	}
+}
+
+// DialTLSContext returns a function for http.Transport establishing TLS
+// connections with ClientTLSConfig for the host dialed, offering
+// nextProtos with ALPN.
+func (s *Store) DialTLSContext(nextProtos ...string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config := s.ClientTLSConfig(host)
+		config.NextProtos = nextProtos
+		dialer := &tls.Dialer{Config: config}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+func (s *Store) verifyServer(state tls.ConnectionState, host string) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         s.CAPool(),
+		Intermediates: intermediates,
+		DNSName:       host,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify server certificate: %w", err)
+	}
+	return nil
+}
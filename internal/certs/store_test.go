@@ -0,0 +1,257 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/pkg/pki"
+)
+
+// writeSelfSigned writes a certificate for 127.0.0.1 and its key to
+// certPath and keyPath. The certificate is its own CA.
+func writeSelfSigned(t *testing.T, certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Failed to generate serial number: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "sepp.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+func newStore(t *testing.T, dir string) (*certs.Store, string, string) {
+	certPath, keyPath := filepath.Join(dir, "sepp.crt"), filepath.Join(dir, "sepp.key")
+	writeSelfSigned(t, certPath, keyPath)
+	store, err := certs.NewStore(certPath, keyPath, certPath, log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	return store, certPath, keyPath
+}
+
+func TestGivenCAWithoutCertificateWhenNewStoreThenErrInvalidCAIsReturned(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "sepp.crt"), filepath.Join(dir, "sepp.key")
+	writeSelfSigned(t, certPath, keyPath)
+
+	_, err := certs.NewStore(certPath, keyPath, keyPath, log.Default())
+
+	if !errors.Is(err, certs.ErrInvalidCA) {
+		t.Errorf("Expected ErrInvalidCA, got %v", err)
+	}
+}
+
+func TestGivenRenewedCertificateWhenReloadThenNewCertificateIsUsed(t *testing.T) {
+	store, certPath, keyPath := newStore(t, t.TempDir())
+	previous := store.Certificate()
+	writeSelfSigned(t, certPath, keyPath)
+
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	if store.Certificate() == previous {
+		t.Errorf("Expected the renewed certificate to be used")
+	}
+}
+
+func TestGivenInvalidKeyWhenReloadThenPreviousCertificateIsKept(t *testing.T) {
+	store, _, keyPath := newStore(t, t.TempDir())
+	previous := store.Certificate()
+	if err := os.WriteFile(keyPath, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	err := store.Reload()
+
+	if !errors.Is(err, certs.ErrCertLoad) {
+		t.Errorf("Expected ErrCertLoad, got %v", err)
+	}
+	if store.Certificate() != previous {
+		t.Errorf("Expected the previous certificate to be kept")
+	}
+}
+
+func TestGivenUnchangedFilesWhenReloadIfModifiedThenNothingIsReloaded(t *testing.T) {
+	store, _, _ := newStore(t, t.TempDir())
+	previous := store.Certificate()
+
+	if err := store.ReloadIfModified(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	if store.Certificate() != previous {
+		t.Errorf("Expected the certificate not to be reloaded")
+	}
+}
+
+func TestGivenModifiedFilesWhenReloadIfModifiedThenNewCertificateIsUsed(t *testing.T) {
+	store, certPath, keyPath := newStore(t, t.TempDir())
+	previous := store.Certificate()
+	writeSelfSigned(t, certPath, keyPath)
+	// Make the change visible on file systems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certPath, later, later); err != nil {
+		t.Fatalf("Failed to touch certificate: %v", err)
+	}
+
+	if err := store.ReloadIfModified(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	if store.Certificate() == previous {
+		t.Errorf("Expected the renewed certificate to be used")
+	}
+}
+
+func TestGivenRotatedPKIWhenReloadThenNewConnectionsUseIt(t *testing.T) {
+	_, serverCert, serverKey := newStore(t, t.TempDir())
+	clientDir := t.TempDir()
+	clientCert, clientKey := filepath.Join(clientDir, "client.crt"), filepath.Join(clientDir, "client.key")
+	writeSelfSigned(t, clientCert, clientKey)
+	// Each side trusts the certificate of the other one.
+	clientStore, err := certs.NewStore(clientCert, clientKey, serverCert, log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create client store: %v", err)
+	}
+	serverStore, err := certs.NewStore(serverCert, serverKey, clientCert, log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create server store: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = serverStore.ServerTLSConfig()
+	server.StartTLS()
+	defer server.Close()
+	get := func() error {
+		client := &http.Client{Transport: &http.Transport{DialTLSContext: clientStore.DialTLSContext()}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	if err := get(); err != nil {
+		t.Fatalf("Failed to connect before rotation: %v", err)
+	}
+
+	writeSelfSigned(t, serverCert, serverKey)
+	writeSelfSigned(t, clientCert, clientKey)
+	if err := serverStore.Reload(); err != nil {
+		t.Fatalf("Failed to reload server store: %v", err)
+	}
+	if err := get(); err == nil {
+		t.Fatalf("Expected the client to reject the renewed server certificate before reload")
+	}
+	if err := clientStore.Reload(); err != nil {
+		t.Fatalf("Failed to reload client store: %v", err)
+	}
+
+	if err := get(); err != nil {
+		t.Errorf("Failed to connect after rotation: %v", err)
+	}
+}
+
+// serveWithCertificateFor starts a TLS server on 127.0.0.1 whose
+// certificate, issued by a CA trusted by the returned client store, is
+// valid for hosts.
+func serveWithCertificateFor(t *testing.T, hosts ...string) (*httptest.Server, *certs.Store) {
+	dir := t.TempDir()
+	ca, err := pki.NewCA(pki.Options{CommonName: "CA", Validity: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	if err := ca.IssueSEPP(dir, pki.SEPPOptions{N32Hosts: hosts, Validity: time.Hour}, pki.N32ServerName, pki.N32ClientName); err != nil {
+		t.Fatalf("Failed to issue certificates: %v", err)
+	}
+	serverStore, err := certs.NewStore(filepath.Join(dir, "n32Server.crt"), filepath.Join(dir, "n32Server.key"), filepath.Join(dir, pki.CACertFile), log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create server store: %v", err)
+	}
+	clientStore, err := certs.NewStore(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), filepath.Join(dir, pki.CACertFile), log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create client store: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = serverStore.ServerTLSConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, clientStore
+}
+
+func TestGivenCertificateOfAnotherHostWhenDialTLSThenServerIsRejected(t *testing.T) {
+	server, clientStore := serveWithCertificateFor(t, "other.example.com")
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{DialTLSContext: clientStore.DialTLSContext()}}
+	defer client.CloseIdleConnections()
+
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		resp, err := client.Get("https://" + net.JoinHostPort(host, port))
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected the certificate of other.example.com to be rejected for %s", host)
+		}
+	}
+}
+
+func TestGivenCertificateOfDialedHostWhenDialTLSThenServerIsAccepted(t *testing.T) {
+	server, clientStore := serveWithCertificateFor(t, "localhost", "127.0.0.1")
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	client := &http.Client{Transport: &http.Transport{DialTLSContext: clientStore.DialTLSContext()}}
+	defer client.CloseIdleConnections()
+
+	for _, host := range []string{"localhost", "127.0.0.1"} {
+		resp, err := client.Get("https://" + net.JoinHostPort(host, port))
+		if err != nil {
+			t.Errorf("Failed to connect to %s: %v", host, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,99 @@
+package certs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Watcher keeps the stores of a SEPP up to date with their files.
+type Watcher struct {
+	logger *log.Logger
+	mu     sync.Mutex
+	stores map[[3]string]*watchedStore
+}
+
+type watchedStore struct {
+	store *Store
+	users int
+}
+
+func NewWatcher(logger *log.Logger) *Watcher {
+	return &Watcher{logger: logger, stores: make(map[[3]string]*watchedStore)}
+}
+
+// Load returns the store of the given files, shared by every component
+// using them.
+func (w *Watcher) Load(certPath, keyPath, caPath string) (*Store, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := [3]string{certPath, keyPath, caPath}
+	if watched, ok := w.stores[key]; ok {
+		watched.users++
+		return watched.store, nil
+	}
+	store, err := NewStore(certPath, keyPath, caPath, w.logger)
+	if err != nil {
+		return nil, err
+	}
+	w.stores[key] = &watchedStore{store: store, users: 1}
+	return store, nil
+}
+
+// Release stops watching the files of store once no component returned
+// it by Load uses it anymore.
+func (w *Watcher) Release(store *Store) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := [3]string{store.certPath, store.keyPath, store.caPath}
+	watched, ok := w.stores[key]
+	if !ok || watched.store != store {
+		return
+	}
+	watched.users--
+	if watched.users == 0 {
+		delete(w.stores, key)
+	}
+}
+
+// Reload reloads every store and returns the errors of those keeping
+// their previous material.
+func (w *Watcher) Reload() error {
+	var errs []error
+	for _, store := range w.list() {
+		if err := store.Reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run reloads the stores whose files changed every interval until ctx is
+// done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, store := range w.list() {
+				// Failures are logged by the store.
+				_ = store.ReloadIfModified()
+			}
+		}
+	}
+}
+
+func (w *Watcher) list() []*Store {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stores := make([]*Store, 0, len(w.stores))
+	for _, watched := range w.stores {
+		stores = append(stores, watched.store)
+	}
+	return stores
+}
@@ -1,20 +1,369 @@
 package model
 
 import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type FQDN string
 
+// Host returns the host name of the FQDN, which this SEPP sets to the URL
+// of its N32 interface.
+func (f FQDN) Host() string {
+	if u, err := url.Parse(string(f)); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	if host, _, err := net.SplitHostPort(string(f)); err == nil {
+		return host
+	}
+	return string(f)
+}
+
 type SecurityCapability string
 
 const TLS = SecurityCapability("TLS")
+const PRINS = SecurityCapability("PRINS")
+const NONE = SecurityCapability("NONE")
 const ALS = SecurityCapability("ALS")
 
+// SelectSecurityCapability returns the first capability of the ordered
+// preferred list that is also present in offered.
+func SelectSecurityCapability(preferred []SecurityCapability, offered []SecurityCapability) (SecurityCapability, bool) {
+	for _, capability := range preferred {
+		if slices.Contains(offered, capability) {
+			return capability, true
+		}
+	}
+	return "", false
+}
+
+type PlmnId struct {
+	Mcc string `json:"mcc"`
+	Mnc string `json:"mnc"`
+}
+
+type PlmnIdNid struct {
+	Mcc string `json:"mcc"`
+	Mnc string `json:"mnc"`
+	Nid string `json:"nid,omitempty"`
+}
+
+// Equal compares PLMN IDs ignoring the zero padding of 2 digit MNCs,
+// which 3GPP FQDNs always encode on 3 digits.
+func (p PlmnId) Equal(other PlmnId) bool {
+	return p.Mcc == other.Mcc && strings.TrimLeft(p.Mnc, "0") == strings.TrimLeft(other.Mnc, "0")
+}
+
+// PlmnIdFromFQDN extracts the PLMN ID of a 3GPP network domain such as
+// nudm.5gc.mnc001.mcc001.3gppnetwork.org.
+func PlmnIdFromFQDN(fqdn string) (PlmnId, bool) {
+	match := plmnFQDNPattern.FindStringSubmatch(strings.ToLower(fqdn))
+	if match == nil {
+		return PlmnId{}, false
+	}
+	return PlmnId{Mcc: match[2], Mnc: match[1]}, true
+}
+
+type N32Purpose string
+
+const (
+	Roaming                   = N32Purpose("ROAMING")
+	InterPlmnMobility         = N32Purpose("INTER_PLMN_MOBILITY")
+	SmsInterconnect           = N32Purpose("SMS_INTERCONNECT")
+	RoamingTest               = N32Purpose("ROAMING_TEST")
+	InterPlmnMobilityTest     = N32Purpose("INTER_PLMN_MOBILITY_TEST")
+	SmsInterconnectTest       = N32Purpose("SMS_INTERCONNECT_TEST")
+	SnpnInterconnect          = N32Purpose("SNPN_INTERCONNECT")
+	SnpnInterconnectTest      = N32Purpose("SNPN_INTERCONNECT_TEST")
+	DataAnalyticsExchange     = N32Purpose("DATA_ANALYTICS_EXCHANGE")
+	DataAnalyticsExchangeTest = N32Purpose("DATA_ANALYTICS_EXCHANGE_TEST")
+)
+
+type IntendedN32Purpose struct {
+	UsagePurpose   N32Purpose `json:"usagePurpose"`
+	AdditionalInfo string     `json:"additionalInfo,omitempty"`
+}
+
+type SupportedFeatures string
+
+// N32fContext is the state of a peering established by an N32-c
+// handshake. PRINS is only set when PRINS was negotiated. RemoteN32fURL
+// is only set when the remote SEPP asked for N32-f traffic to be sent
+// elsewhere than to its N32-c endpoint.
+type N32fContext struct {
+	N32fContextID      string
+	RemoteN32FQDN      FQDN
+	RemoteN32fURL      string
+	SecurityCapability SecurityCapability
+	PRINS              *PRINSContext
+
+	// established orders the contexts by the time they were added.
+	established uint64
+}
+
+// N32fURL returns the URL N32-f traffic to the remote SEPP is sent to.
+func (c *N32fContext) N32fURL() string {
+	if c.RemoteN32fURL != "" {
+		return c.RemoteN32fURL
+	}
+	return string(c.RemoteN32FQDN)
+}
+
+// RemoteSEPP is a roaming partner SEPP serving PlmnId and reachable at
+// URL. The TLS files authenticate the local SEPP towards it.
+type RemoteSEPP struct {
+	PlmnId     PlmnId
+	URL        string
+	ClientCert string
+	ClientKey  string
+	CA         string
+}
+
+// LocalRoute sends the requests received from remote SEPPs whose path
+// starts with ApiPrefix to the local NF at ApiRoot, with HTTP/2 in
+// cleartext if H2C is set and ApiRoot is http.
+type LocalRoute struct {
+	ApiPrefix string
+	ApiRoot   string
+	H2C       bool
+}
+
+// Settings are the parts of the SEPPContext that follow configuration
+// reloads. They are never modified once in use, UpdateSettings replaces
+// them.
+type Settings struct {
+	// LocalN32FQDN and LocalSBIFQDN are those of the local SEPP, whose
+	// interfaces are kept across reloads.
+	LocalN32FQDN                  FQDN
+	LocalSBIFQDN                  FQDN
+	RemoteSEPPs                   []RemoteSEPP
+	SupportedSecurityCapabilities []SecurityCapability
+	ProtectionPolicy              ProtectionPolicy
+	JweCipherSuites               []string
+	JwsCipherSuites               []string
+	IpxProviderSecInfoList        []IpxProviderSecInfo
+}
+
+// GetRemoteSEPP returns the roaming partner serving plmnId.
+func (s *Settings) GetRemoteSEPP(plmnId PlmnId) (RemoteSEPP, bool) {
+	for _, remoteSEPP := range s.RemoteSEPPs {
+		if remoteSEPP.PlmnId.Equal(plmnId) {
+			return remoteSEPP, true
+		}
+	}
+	return RemoteSEPP{}, false
+}
+
+// GetRemoteSEPPByFQDN returns the roaming partner whose N32 interface is
+// at fqdn, given as its configured URL or as its host name.
+func (s *Settings) GetRemoteSEPPByFQDN(fqdn FQDN) (RemoteSEPP, bool) {
+	for _, remoteSEPP := range s.RemoteSEPPs {
+		if FQDN(remoteSEPP.URL) == fqdn {
+			return remoteSEPP, true
+		}
+	}
+	for _, remoteSEPP := range s.RemoteSEPPs {
+		if FQDN(remoteSEPP.URL).Host() == string(fqdn) {
+			return remoteSEPP, true
+		}
+	}
+	return RemoteSEPP{}, false
+}
+
+// SEPPContext is shared by the N32 and SBI servers. N32fContexts is only
+// modified with Mu held; every modification publishes an immutable
+// snapshot from which the forwarding path reads without locking. The
+// configuration is read through Settings so that reloads are followed.
 type SEPPContext struct {
-	LocalN32FQDN                FQDN
-	RemoteN32FQDN               FQDN
-	SupportedSecurityCapability SecurityCapability
-	SelectedSecurityCapability  SecurityCapability
-	Mu                          sync.Mutex
+	N32fContexts map[string]*N32fContext
+	Mu           sync.Mutex
+	// Log receives the messages of the SEPP, the standard logger is used
+	// when nil.
+	Log *log.Logger
+
+	established uint64
+	snapshot    atomic.Pointer[n32fSnapshot]
+	settings    atomic.Pointer[Settings]
+}
+
+// n32fSnapshot is a read-only view of the N32-f contexts.
+type n32fSnapshot struct {
+	byID map[string]*N32fContext
+	// byPeer holds the latest context established with each remote SEPP.
+	byPeer map[FQDN]*N32fContext
+}
+
+// publish replaces the snapshot after N32fContexts was modified. It must
+// be called with Mu held.
+func (c *SEPPContext) publish() {
+	snapshot := &n32fSnapshot{
+		byID:   make(map[string]*N32fContext, len(c.N32fContexts)),
+		byPeer: make(map[FQDN]*N32fContext),
+	}
+	for n32fContextID, n32fContext := range c.N32fContexts {
+		snapshot.byID[n32fContextID] = n32fContext
+		if latest, ok := snapshot.byPeer[n32fContext.RemoteN32FQDN]; !ok || n32fContext.established > latest.established {
+			snapshot.byPeer[n32fContext.RemoteN32FQDN] = n32fContext
+		}
+	}
+	c.snapshot.Store(snapshot)
+}
+
+func (c *SEPPContext) load() *n32fSnapshot {
+	if snapshot := c.snapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+	return &n32fSnapshot{}
+}
+
+func (c *SEPPContext) Logger() *log.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return log.Default()
+}
+
+// NewSEPPContext returns a context using settings until they are
+// updated.
+func NewSEPPContext(settings Settings) *SEPPContext {
+	seppContext := &SEPPContext{}
+	seppContext.UpdateSettings(settings)
+	return seppContext
+}
+
+// Settings returns the settings in use, empty ones if none were set.
+func (c *SEPPContext) Settings() *Settings {
+	if settings := c.settings.Load(); settings != nil {
+		return settings
+	}
+	return &Settings{}
+}
+
+// UpdateSettings replaces the settings in use. Established N32-f contexts
+// keep what was negotiated with them.
+func (c *SEPPContext) UpdateSettings(settings Settings) {
+	c.settings.Store(&settings)
+}
+
+// GetRemoteSEPP returns the roaming partner serving plmnId.
+func (c *SEPPContext) GetRemoteSEPP(plmnId PlmnId) (RemoteSEPP, bool) {
+	return c.Settings().GetRemoteSEPP(plmnId)
+}
+
+// AddN32fContext stores a context created by an N32-c handshake.
+func (c *SEPPContext) AddN32fContext(n32fContext *N32fContext) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	if c.N32fContexts == nil {
+		c.N32fContexts = make(map[string]*N32fContext)
+	}
+	c.established++
+	n32fContext.established = c.established
+	c.N32fContexts[n32fContext.N32fContextID] = n32fContext
+	c.publish()
+}
+
+func (c *SEPPContext) GetN32fContext(n32fContextID string) (*N32fContext, bool) {
+	n32fContext, ok := c.load().byID[n32fContextID]
+	return n32fContext, ok
+}
+
+// ListN32fContexts returns every established context.
+func (c *SEPPContext) ListN32fContexts() []*N32fContext {
+	snapshot := c.load()
+	n32fContexts := make([]*N32fContext, 0, len(snapshot.byID))
+	for _, n32fContext := range snapshot.byID {
+		n32fContexts = append(n32fContexts, n32fContext)
+	}
+	return n32fContexts
+}
+
+// RemoveN32fContext deletes a terminated context. Nothing is forwarded
+// to the remote SEPP once no context with it is left.
+func (c *SEPPContext) RemoveN32fContext(n32fContextID string) (*N32fContext, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	n32fContext, ok := c.N32fContexts[n32fContextID]
+	if !ok {
+		return nil, false
+	}
+	delete(c.N32fContexts, n32fContextID)
+	c.publish()
+	return n32fContext, true
+}
+
+// GetPeerN32fContext returns the latest context established with the
+// remote SEPP, so that traffic follows a re-negotiation. Both ends keep
+// all the contexts created by N32-c handshakes in either direction.
+func (c *SEPPContext) GetPeerN32fContext(remoteN32FQDN FQDN) (*N32fContext, bool) {
+	n32fContext, ok := c.load().byPeer[remoteN32FQDN]
+	return n32fContext, ok
+}
+
+func (c *SEPPContext) GetPRINSContext(n32fContextID string) (*PRINSContext, bool) {
+	n32fContext, ok := c.load().byID[n32fContextID]
+	if !ok || n32fContext.PRINS == nil {
+		return nil, false
+	}
+	return n32fContext.PRINS, true
+}
+
+// UpdatePRINSContext applies update to a copy of the PRINS context and
+// replaces it, so that readers holding the previous one are not affected.
+func (c *SEPPContext) UpdatePRINSContext(n32fContextID string, update func(*PRINSContext)) bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	n32fContext, ok := c.N32fContexts[n32fContextID]
+	if !ok || n32fContext.PRINS == nil {
+		return false
+	}
+	updatedPRINS := *n32fContext.PRINS
+	update(&updatedPRINS)
+	updated := *n32fContext
+	updated.PRINS = &updatedPRINS
+	c.N32fContexts[n32fContextID] = &updated
+	c.publish()
+	return true
+}
+
+var (
+	mccPattern               = regexp.MustCompile(`^[0-9]{3}$`)
+	mncPattern               = regexp.MustCompile(`^[0-9]{2,3}$`)
+	nidPattern               = regexp.MustCompile(`^[A-Fa-f0-9]{11}$`)
+	supportedFeaturesPattern = regexp.MustCompile(`^[A-Fa-f0-9]*$`)
+	plmnFQDNPattern          = regexp.MustCompile(`(?:^|\.)mnc([0-9]{3})\.mcc([0-9]{3})\.3gppnetwork\.org\.?$`)
+)
+
+func (p PlmnId) Validate() error {
+	if !mccPattern.MatchString(p.Mcc) {
+		return fmt.Errorf("invalid mcc %q", p.Mcc)
+	}
+	if !mncPattern.MatchString(p.Mnc) {
+		return fmt.Errorf("invalid mnc %q", p.Mnc)
+	}
+	return nil
+}
+
+func (p PlmnIdNid) Validate() error {
+	if err := (PlmnId{Mcc: p.Mcc, Mnc: p.Mnc}).Validate(); err != nil {
+		return err
+	}
+	if p.Nid != "" && !nidPattern.MatchString(p.Nid) {
+		return fmt.Errorf("invalid nid %q", p.Nid)
+	}
+	return nil
+}
+
+func (f SupportedFeatures) Validate() error {
+	if !supportedFeaturesPattern.MatchString(string(f)) {
+		return fmt.Errorf("invalid supported features %q", f)
+	}
+	return nil
 }
@@ -0,0 +1,93 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+func TestGiven3GPPFQDNWhenPlmnIdFromFQDNThenPlmnIdIsReturned(t *testing.T) {
+	plmnId, ok := model.PlmnIdFromFQDN("nudm.5gc.mnc001.mcc208.3gppnetwork.org")
+
+	if !ok {
+		t.Fatalf("Expected PLMN ID to be found")
+	}
+	if plmnId.Mcc != "208" || plmnId.Mnc != "001" {
+		t.Errorf("Expected PLMN ID 208-001, got %s-%s", plmnId.Mcc, plmnId.Mnc)
+	}
+}
+
+func TestGivenOtherFQDNWhenPlmnIdFromFQDNThenNoPlmnIdIsReturned(t *testing.T) {
+	if plmnId, ok := model.PlmnIdFromFQDN("nudm.example.com"); ok {
+		t.Errorf("Expected no PLMN ID, got %+v", plmnId)
+	}
+}
+
+func TestGivenPaddedMncWhenGetRemoteSEPPThenRemoteSEPPIsFound(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		RemoteSEPPs: []model.RemoteSEPP{
+			{PlmnId: model.PlmnId{Mcc: "208", Mnc: "01"}, URL: "https://sepp.5gc.mnc001.mcc208.3gppnetwork.org"},
+			{PlmnId: model.PlmnId{Mcc: "208", Mnc: "010"}, URL: "https://sepp.5gc.mnc010.mcc208.3gppnetwork.org"},
+		},
+	})
+
+	remoteSEPP, ok := seppContext.GetRemoteSEPP(model.PlmnId{Mcc: "208", Mnc: "001"})
+
+	if !ok || remoteSEPP.URL != "https://sepp.5gc.mnc001.mcc208.3gppnetwork.org" {
+		t.Errorf("Unexpected remote SEPP %+v", remoteSEPP)
+	}
+}
+
+func TestGivenRenegotiatedContextWhenGetPeerN32fContextThenLatestContextIsReturned(t *testing.T) {
+	seppContext := &model.SEPPContext{}
+	for _, n32fContextID := range []string{"0000000000000001", "0000000000000002", "0000000000000003"} {
+		seppContext.AddN32fContext(&model.N32fContext{N32fContextID: n32fContextID, RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: model.TLS})
+	}
+
+	n32fContext, ok := seppContext.GetPeerN32fContext("https://remote-sepp.example.com")
+	if !ok || n32fContext.N32fContextID != "0000000000000003" {
+		t.Fatalf("Expected latest N32-f context, got %+v", n32fContext)
+	}
+
+	seppContext.RemoveN32fContext("0000000000000003")
+	n32fContext, ok = seppContext.GetPeerN32fContext("https://remote-sepp.example.com")
+	if !ok || n32fContext.N32fContextID != "0000000000000002" {
+		t.Errorf("Expected previous N32-f context, got %+v", n32fContext)
+	}
+}
+
+func TestGivenUpdatedSettingsWhenGetRemoteSEPPThenNewRemoteSEPPsAreUsed(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		RemoteSEPPs: []model.RemoteSEPP{{PlmnId: model.PlmnId{Mcc: "001", Mnc: "01"}, URL: "https://old-sepp.example.com"}},
+	})
+	if _, ok := seppContext.GetRemoteSEPP(model.PlmnId{Mcc: "001", Mnc: "01"}); !ok {
+		t.Fatalf("Expected the initial remote SEPP to be found")
+	}
+
+	seppContext.UpdateSettings(model.Settings{
+		RemoteSEPPs: []model.RemoteSEPP{{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: "https://new-sepp.example.com"}},
+	})
+
+	if _, ok := seppContext.GetRemoteSEPP(model.PlmnId{Mcc: "001", Mnc: "01"}); ok {
+		t.Errorf("Expected the removed remote SEPP not to be found")
+	}
+	if remoteSEPP, ok := seppContext.GetRemoteSEPP(model.PlmnId{Mcc: "002", Mnc: "02"}); !ok || remoteSEPP.URL != "https://new-sepp.example.com" {
+		t.Errorf("Expected the added remote SEPP, got %v", remoteSEPP)
+	}
+}
+
+func TestGivenHostNameWhenGetRemoteSEPPByFQDNThenRemoteSEPPWithThatURLIsReturned(t *testing.T) {
+	settings := &model.Settings{RemoteSEPPs: []model.RemoteSEPP{
+		{PlmnId: model.PlmnId{Mcc: "001", Mnc: "01"}, URL: "https://sepp-a.example.com:1233"},
+		{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: "https://sepp-b.example.com"},
+	}}
+
+	remoteSEPP, ok := settings.GetRemoteSEPPByFQDN("sepp-b.example.com")
+
+	if !ok || remoteSEPP.PlmnId.Mcc != "002" {
+		t.Errorf("Expected remote SEPP of PLMN 002-02, got %+v", remoteSEPP)
+	}
+	if host := model.FQDN("https://sepp-a.example.com:1233").Host(); host != "sepp-a.example.com" {
+		t.Errorf("Expected host 'sepp-a.example.com', got '%s'", host)
+	}
+}
@@ -0,0 +1,76 @@
+package model
+
+type IeLocation string
+
+const (
+	IeLocationUriParam        = IeLocation("URI_PARAM")
+	IeLocationHeader          = IeLocation("HEADER")
+	IeLocationBody            = IeLocation("BODY")
+	IeLocationMultipartBinary = IeLocation("MULTIPART_BINARY")
+)
+
+type IeType string
+
+const (
+	IeTypeUeId                   = IeType("UEID")
+	IeTypeLocation               = IeType("LOCATION")
+	IeTypeKeyMaterial            = IeType("KEY_MATERIAL")
+	IeTypeAuthenticationMaterial = IeType("AUTHENTICATION_MATERIAL")
+	IeTypeAuthorizationToken     = IeType("AUTHORIZATION_TOKEN")
+	IeTypeOther                  = IeType("OTHER")
+	IeTypeNonSensitive           = IeType("NONSENSITIVE")
+)
+
+type IeInfo struct {
+	IeLoc        IeLocation `json:"ieLoc"`
+	IeType       IeType     `json:"ieType"`
+	ReqIe        string     `json:"reqIe,omitempty"`
+	RspIe        string     `json:"rspIe,omitempty"`
+	IsModifiable bool       `json:"isModifiable,omitempty"`
+}
+
+type ApiSignature struct {
+	CApiSignature string `json:"cApiSignature,omitempty"`
+	Uri           string `json:"uri,omitempty"`
+}
+
+type ApiIeMapping struct {
+	ApiSignature ApiSignature `json:"apiSignature"`
+	ApiMethod    string       `json:"apiMethod"`
+	IeList       []IeInfo     `json:"IeList"`
+}
+
+// ProtectionPolicy lists, per API, the IEs that PRINS protects and
+// which IE types must be encrypted (TS 29.573 clause 6.1.5.3.6).
+type ProtectionPolicy struct {
+	ApiIeMappingList  []ApiIeMapping `json:"apiIeMappingList"`
+	DataTypeEncPolicy []IeType       `json:"dataTypeEncPolicy,omitempty"`
+}
+
+type IpxProviderSecInfo struct {
+	IpxProviderId    string   `json:"ipxProviderId"`
+	RawPublicKeyList []string `json:"rawPublicKeyList,omitempty"`
+	CertificateList  []string `json:"certificateList,omitempty"`
+}
+
+// PRINSKeys are the N32-f session keys derived from the N32-c TLS
+// session as described in TS 33.501 clause 13.2.4.4.
+type PRINSKeys struct {
+	SendRequestKey     []byte
+	ReceiveResponseKey []byte
+	ReceiveRequestKey  []byte
+	SendResponseKey    []byte
+}
+
+// PRINSContext holds the security parameters of an N32-f context. The
+// cipher suites and protection policy start from local defaults and are
+// updated by the N32-c parameter exchange.
+type PRINSContext struct {
+	N32fContextID                string
+	RemoteN32FQDN                FQDN
+	Keys                         PRINSKeys
+	JweCipherSuite               string
+	JwsCipherSuite               string
+	ProtectionPolicy             ProtectionPolicy
+	RemoteIpxProviderSecInfoList []IpxProviderSecInfo
+}
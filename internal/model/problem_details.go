@@ -0,0 +1,47 @@
+package model
+
+import "fmt"
+
+// Application errors defined in TS 29.500 clause 5.2.7 and TS 29.573 clause 6.1.7.
+const (
+	CauseInvalidMsgFormat                    = "INVALID_MSG_FORMAT"
+	CauseMandatoryIeIncorrect                = "MANDATORY_IE_INCORRECT"
+	CauseMandatoryIeMissing                  = "MANDATORY_IE_MISSING"
+	CauseOptionalIeIncorrect                 = "OPTIONAL_IE_INCORRECT"
+	CauseUnsupportedSecurityCapability       = "UNSUPPORTED_SECURITY_CAPABILITY"
+	CauseSystemFailure                       = "SYSTEM_FAILURE"
+	CauseTargetNfNotReachable                = "TARGET_NF_NOT_REACHABLE"
+	CauseNfServiceFailover                   = "NF_SERVICE_FAILOVER"
+	CauseUnspecifiedMsgFailure               = "UNSPECIFIED_MSG_FAILURE"
+	CauseContextNotFound                     = "CONTEXT_NOT_FOUND"
+	CauseIntegrityCheckFailed                = "INTEGRITY_CHECK_FAILED"
+	CauseIntegrityCheckOnModificationsFailed = "INTEGRITY_CHECK_ON_MODIFICATIONS_FAILED"
+	CausePolicyMismatch                      = "POLICY_MISMATCH"
+	CauseUnsupportedCipherSuite              = "UNSUPPORTED_CIPHER_SUITE"
+)
+
+type InvalidParam struct {
+	Param  string `json:"param"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type ProblemDetails struct {
+	Type          string         `json:"type,omitempty"`
+	Title         string         `json:"title,omitempty"`
+	Status        int            `json:"status,omitempty"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Cause         string         `json:"cause,omitempty"`
+	InvalidParams []InvalidParam `json:"invalidParams,omitempty"`
+}
+
+func (p *ProblemDetails) Error() string {
+	reason := p.Cause
+	if reason == "" {
+		reason = p.Title
+	}
+	if p.Detail == "" {
+		return fmt.Sprintf("%d %s", p.Status, reason)
+	}
+	return fmt.Sprintf("%d %s: %s", p.Status, reason, p.Detail)
+}
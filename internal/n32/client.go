@@ -2,73 +2,179 @@ package n32
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+
+	"github.com/dot-5g/sepp/internal/prins"
+	"github.com/dot-5g/sepp/internal/problem"
 )
 
 type Client struct {
 	httpClient *http.Client
+	logger     *log.Logger
 }
 
-func NewClient(certPath string, keyPath string, caCertPath string) *Client {
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+// NewClient returns a client sending its requests over transport,
+// usually the one of the Peer of the remote SEPP.
+func NewClient(transport http.RoundTripper, logger *log.Logger) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Transport: transport,
+		},
+		logger: logger,
+	}
+}
+
+// POSTExchangeCapability performs the N32-c security capability
+// negotiation. It also returns the state of the TLS session the
+// negotiation took place on, from which PRINS keys are derived.
+func (c *Client) POSTExchangeCapability(ctx context.Context, remoteURL string, secNegotiateReqData SecNegotiateReqData) (SecNegotiateRspData, *tls.ConnectionState, error) {
+	secNegotiateRspData := SecNegotiateRspData{}
+	jsonData, err := json.Marshal(secNegotiateReqData)
+	if err != nil {
+		return secNegotiateRspData, nil, err
+	}
+
+	endpoint := remoteURL + "/n32c-handshake/v1/exchange-capability"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return secNegotiateRspData, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		log.Fatalf("N32 client - failed to load client certificate: %v", err)
+		return secNegotiateRspData, nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return secNegotiateRspData, nil, fmt.Errorf("unexpected response status: %w", problem.Read(resp))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&secNegotiateRspData)
+	if err != nil {
+		return secNegotiateRspData, nil, err
+	}
+	c.logger.Printf("n32 client - successfully exchanged capability %s with remote SEPP %s", secNegotiateRspData.SelectedSecCapability, remoteURL)
+
+	return secNegotiateRspData, resp.TLS, nil
+}
 
-	caCert, err := os.ReadFile(caCertPath)
+func (c *Client) POSTExchangeParams(ctx context.Context, remoteURL string, secParamExchReqData SecParamExchReqData) (SecParamExchRspData, error) {
+	secParamExchRspData := SecParamExchRspData{}
+	jsonData, err := json.Marshal(secParamExchReqData)
 	if err != nil {
-		log.Fatalf("N32 client - failed to read CA certificate: %v", err)
+		return secParamExchRspData, err
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
+	endpoint := remoteURL + "/n32c-handshake/v1/exchange-params"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return secParamExchRspData, err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	return &Client{
-		httpClient: &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: tlsConfig,
-			},
-		},
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return secParamExchRspData, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return secParamExchRspData, fmt.Errorf("unexpected response status: %w", problem.Read(resp))
 	}
+	err = json.NewDecoder(resp.Body).Decode(&secParamExchRspData)
+	if err != nil {
+		return secParamExchRspData, err
+	}
+	c.logger.Printf("n32 client - successfully exchanged parameters of N32-f context %s with remote SEPP %s", secParamExchRspData.N32fContextId, remoteURL)
+
+	return secParamExchRspData, nil
 }
 
-func (c *Client) POSTExchangeCapability(remoteURL string, secNegotiateReqData SecNegotiateReqData) (SecNegotiateRspData, error) {
-	secNegotiateRspData := SecNegotiateRspData{}
-	jsonData, err := json.Marshal(secNegotiateReqData)
+// POSTN32fTerminate asks the remote SEPP to delete the N32-f context.
+func (c *Client) POSTN32fTerminate(ctx context.Context, remoteURL string, n32fContextID string) error {
+	jsonData, err := json.Marshal(N32fContextInfo{N32fContextId: n32fContextID})
 	if err != nil {
-		return secNegotiateRspData, err
+		return err
 	}
 
-	endpoint := remoteURL + "/n32c-handshake/v1/exchange-capability"
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	endpoint := remoteURL + "/n32c-handshake/v1/n32f-terminate"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return secNegotiateRspData, err
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return secNegotiateRspData, err
+		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return secNegotiateRspData, fmt.Errorf("unexpected response status: %s", resp.Status)
+		return fmt.Errorf("unexpected response status: %w", problem.Read(resp))
 	}
-	err = json.NewDecoder(resp.Body).Decode(&secNegotiateRspData)
+	c.logger.Printf("n32 client - successfully terminated N32-f context %s with remote SEPP %s", n32fContextID, remoteURL)
+
+	return nil
+}
+
+// POSTN32fError reports to the remote SEPP that an N32-f message it
+// sent was rejected.
+func (c *Client) POSTN32fError(ctx context.Context, remoteURL string, n32fErrorInfo N32fErrorInfo) error {
+	jsonData, err := json.Marshal(n32fErrorInfo)
+	if err != nil {
+		return err
+	}
+
+	endpoint := remoteURL + "/n32c-handshake/v1/n32f-error"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return secNegotiateRspData, err
+		return err
 	}
-	log.Printf("n32 client - successfully exchanged capability %s with remote SEPP %s", secNegotiateRspData.SelectedSecCapability, remoteURL)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected response status: %w", problem.Read(resp))
+	}
+	c.logger.Printf("n32 client - reported N32-f error %s for message %s to remote SEPP %s", n32fErrorInfo.N32fErrorType, n32fErrorInfo.N32fMessageId, remoteURL)
+
+	return nil
+}
+
+// POSTN32fProcess sends a PRINS protected message to the remote SEPP.
+// Error responses are returned as *model.ProblemDetails.
+func (c *Client) POSTN32fProcess(ctx context.Context, remoteURL string, reqMsg *prins.N32fReformattedReqMsg) (*prins.N32fReformattedRspMsg, error) {
+	jsonData, err := json.Marshal(reqMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := remoteURL + "/n32f-forward/v1/n32f-process"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
 
-	return secNegotiateRspData, nil
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, problem.Read(resp)
+	}
+	rspMsg := new(prins.N32fReformattedRspMsg)
+	if err := json.NewDecoder(resp.Body).Decode(rspMsg); err != nil {
+		return nil, err
+	}
+	return rspMsg, nil
 }
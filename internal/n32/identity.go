@@ -0,0 +1,53 @@
+package n32
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+// verifySender checks that the SEPP at the other end of the N32-c
+// connection is the roaming partner sender claims to be, as TS 33.501
+// requires: sender must be a configured remote SEPP, the client
+// certificate must be valid for its host and plmnIdList may only hold
+// the PLMN ID configured for it. It returns the remote SEPP, whose URL
+// names it whatever the spelling of sender, or the offending attributes.
+func verifySender(state *tls.ConnectionState, sender model.FQDN, plmnIdList []model.PlmnId, settings *model.Settings) (model.RemoteSEPP, []model.InvalidParam) {
+	remoteSEPP, ok := settings.GetRemoteSEPPByFQDN(sender)
+	if !ok {
+		return remoteSEPP, []model.InvalidParam{{Param: "/sender", Reason: fmt.Sprintf("%s is not a configured remote SEPP", sender)}}
+	}
+	if err := verifyPeer(state, model.FQDN(remoteSEPP.URL)); err != nil {
+		return remoteSEPP, []model.InvalidParam{{Param: "/sender", Reason: err.Error()}}
+	}
+	var invalidParams []model.InvalidParam
+	for i, plmnId := range plmnIdList {
+		if !plmnId.Equal(remoteSEPP.PlmnId) {
+			invalidParams = append(invalidParams, model.InvalidParam{Param: fmt.Sprintf("/plmnIdList/%d", i), Reason: fmt.Sprintf("%s-%s is not served by %s", plmnId.Mcc, plmnId.Mnc, sender)})
+		}
+	}
+	return remoteSEPP, invalidParams
+}
+
+// isSender reports whether sender names the remote SEPP remoteN32FQDN,
+// either as is or as the host of its configured URL.
+func isSender(settings *model.Settings, sender model.FQDN, remoteN32FQDN model.FQDN) bool {
+	if sender == remoteN32FQDN {
+		return true
+	}
+	remoteSEPP, ok := settings.GetRemoteSEPPByFQDN(sender)
+	return ok && model.FQDN(remoteSEPP.URL) == remoteN32FQDN
+}
+
+// verifyPeer checks that the client certificate of the connection is
+// valid for the host of remoteN32FQDN.
+func verifyPeer(state *tls.ConnectionState, remoteN32FQDN model.FQDN) error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no client certificate was presented")
+	}
+	if err := state.PeerCertificates[0].VerifyHostname(remoteN32FQDN.Host()); err != nil {
+		return fmt.Errorf("client certificate does not identify %s: %w", remoteN32FQDN, err)
+	}
+	return nil
+}
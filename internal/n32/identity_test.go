@@ -0,0 +1,241 @@
+package n32_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/pkg/pki"
+)
+
+// remoteSEPPs configures remote-sepp.example.com as the roaming partner
+// serving PLMN 001-01.
+var remoteSEPPs = []model.RemoteSEPP{{PlmnId: model.PlmnId{Mcc: "001", Mnc: "01"}, URL: "https://remote-sepp.example.com"}}
+
+// peerTLS returns the server side state of a TLS connection whose client
+// presented a certificate valid for hosts.
+func peerTLS(t *testing.T, hosts ...string) *tls.ConnectionState {
+	ca, err := pki.NewCA(pki.Options{CommonName: "CA"})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	serverCert, err := ca.Issue(pki.Options{CommonName: "N32 Server", Hosts: []string{"local-sepp.example.com"}})
+	if err != nil {
+		t.Fatalf("Failed to issue server certificate: %v", err)
+	}
+	clientCert, err := ca.Issue(pki.Options{CommonName: "Client", Hosts: hosts})
+	if err != nil {
+		t.Fatalf("Failed to issue client certificate: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	server := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Certificate.Raw}, PrivateKey: serverCert.Key}},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	client := tls.Client(clientConn, &tls.Config{
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{clientCert.Certificate.Raw}, PrivateKey: clientCert.Key}},
+		InsecureSkipVerify: true,
+	})
+	errs := make(chan error, 1)
+	go func() { errs <- client.Handshake() }()
+	if err := server.Handshake(); err != nil {
+		t.Fatalf("Failed to complete TLS handshake: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Failed to complete TLS handshake: %v", err)
+	}
+	state := server.ConnectionState()
+	return &state
+}
+
+func postExchangeCapability(t *testing.T, seppContext *model.SEPPContext, state *tls.ConnectionState, reqData n32.SecNegotiateReqData) (*httptest.ResponseRecorder, model.ProblemDetails) {
+	reqBody, err := json.Marshal(reqData)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = state
+	rr := httptest.NewRecorder()
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+	var problemDetails model.ProblemDetails
+	if rr.Code != http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &problemDetails); err != nil {
+			t.Fatalf("Failed to unmarshal response body: %v", err)
+		}
+	}
+	return rr, problemDetails
+}
+
+func newIdentitySEPPContext() *model.SEPPContext {
+	return model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  "local-sepp.example.com",
+		RemoteSEPPs:                   remoteSEPPs,
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+	})
+}
+
+func TestGivenMatchingCertificateWhenHandlePostExchangeCapabilityThenReturns200(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+
+	rr, _ := postExchangeCapability(t, seppContext, peerTLS(t, "remote-sepp.example.com"), n32.SecNegotiateReqData{
+		Sender:                     "https://remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+		PlmnIdList:                 []model.PlmnId{{Mcc: "001", Mnc: "01"}},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestGivenHostAsSenderWhenHandlePostExchangeCapabilityThenContextIsKeyedByConfiguredURL(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+
+	rr, _ := postExchangeCapability(t, seppContext, peerTLS(t, "remote-sepp.example.com"), n32.SecNegotiateReqData{
+		Sender:                     "remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	n32fContext, ok := seppContext.GetPeerN32fContext(model.FQDN(remoteSEPPs[0].URL))
+	if !ok {
+		t.Fatalf("N32-f context with %s not stored", remoteSEPPs[0].URL)
+	}
+	if n32fContext.RemoteN32FQDN != model.FQDN(remoteSEPPs[0].URL) {
+		t.Errorf("Expected remote N32 FQDN %s, got %s", remoteSEPPs[0].URL, n32fContext.RemoteN32FQDN)
+	}
+}
+
+func TestGivenNoClientCertificateWhenHandlePostExchangeCapabilityThenReturns403(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+
+	rr, problemDetails := postExchangeCapability(t, seppContext, nil, n32.SecNegotiateReqData{
+		Sender:                     "remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+	})
+
+	if rr.Code != http.StatusForbidden || problemDetails.Cause != model.CauseMandatoryIeIncorrect {
+		t.Errorf("Expected 403 with cause %s, got %v with %+v", model.CauseMandatoryIeIncorrect, rr.Code, problemDetails)
+	}
+	if len(seppContext.ListN32fContexts()) != 0 {
+		t.Errorf("N32-f context stored: %v", seppContext.ListN32fContexts())
+	}
+}
+
+func TestGivenCertificateOfAnotherSEPPWhenHandlePostExchangeCapabilityThenReturns403(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+
+	rr, problemDetails := postExchangeCapability(t, seppContext, peerTLS(t, "other-sepp.example.com"), n32.SecNegotiateReqData{
+		Sender:                     "remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+	})
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != "/sender" {
+		t.Errorf("Expected invalid param '/sender', got %+v", problemDetails.InvalidParams)
+	}
+	if len(seppContext.ListN32fContexts()) != 0 {
+		t.Errorf("N32-f context stored: %v", seppContext.ListN32fContexts())
+	}
+}
+
+func TestGivenUnknownSenderWhenHandlePostExchangeCapabilityThenReturns403(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+
+	rr, problemDetails := postExchangeCapability(t, seppContext, peerTLS(t, "other-sepp.example.com"), n32.SecNegotiateReqData{
+		Sender:                     "other-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+	})
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != "/sender" {
+		t.Errorf("Expected invalid param '/sender', got %+v", problemDetails.InvalidParams)
+	}
+}
+
+func TestGivenPlmnIdOfAnotherSEPPWhenHandlePostExchangeCapabilityThenReturns403(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+
+	rr, problemDetails := postExchangeCapability(t, seppContext, peerTLS(t, "remote-sepp.example.com"), n32.SecNegotiateReqData{
+		Sender:                     "remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+		PlmnIdList:                 []model.PlmnId{{Mcc: "001", Mnc: "01"}, {Mcc: "002", Mnc: "02"}},
+	})
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != "/plmnIdList/1" {
+		t.Errorf("Expected invalid param '/plmnIdList/1', got %+v", problemDetails.InvalidParams)
+	}
+}
+
+func TestGivenCertificateOfAnotherSEPPWhenHandleN32fThenReturns403(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: model.TLS})
+	forwarded := false
+	localHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { forwarded = true })
+	req := httptest.NewRequest("GET", "/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	req.TLS = peerTLS(t, "other-sepp.example.com")
+	rr := httptest.NewRecorder()
+
+	n32.HandleN32f(rr, req, seppContext, localHandler)
+
+	if rr.Code != http.StatusForbidden || forwarded {
+		t.Errorf("Expected 403 without forwarding, got %v and forwarded %v", rr.Code, forwarded)
+	}
+}
+
+func TestGivenCertificateOfAnotherSEPPWhenHandlePostN32fTerminateThenContextIsKept(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: model.TLS})
+	reqBody, err := json.Marshal(n32.N32fContextInfo{N32fContextId: "0123456789abcdef"})
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/n32c-handshake/v1/n32f-terminate", bytes.NewBuffer(reqBody))
+	req.TLS = peerTLS(t, "other-sepp.example.com")
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostN32fTerminate(rr, req, seppContext)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if _, ok := seppContext.GetN32fContext("0123456789abcdef"); !ok {
+		t.Errorf("N32-f context was removed")
+	}
+}
+
+func TestGivenCertificateOfAnotherSEPPWhenHandlePostN32fErrorThenReturns403(t *testing.T) {
+	seppContext := newIdentitySEPPContext()
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: model.PRINS})
+
+	rr := postN32fError(t, seppContext, peerTLS(t, "other-sepp.example.com"), n32.N32fErrorInfo{
+		N32fMessageId: "message-1",
+		N32fErrorType: n32.ErrorTypeIntegrityCheckFailed,
+		N32fContextId: "0123456789abcdef",
+	})
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
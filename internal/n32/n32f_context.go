@@ -0,0 +1,68 @@
+package n32
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"strconv"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/prins"
+)
+
+// NewN32fContext creates the N32-f context for the capability negotiated
+// during the N32-c handshake carried by state. initiator is true on the
+// SEPP that sent the exchange-capability request.
+func NewN32fContext(state *tls.ConnectionState, remoteN32FQDN model.FQDN, capability model.SecurityCapability, initiator bool, seppContext *model.SEPPContext) (*model.N32fContext, error) {
+	if capability == model.PRINS {
+		prinsContext, err := prins.NewContext(state, remoteN32FQDN, initiator)
+		if err != nil {
+			return nil, err
+		}
+		prinsContext.ProtectionPolicy = seppContext.Settings().ProtectionPolicy
+		return &model.N32fContext{
+			N32fContextID:      prinsContext.N32fContextID,
+			RemoteN32FQDN:      remoteN32FQDN,
+			SecurityCapability: capability,
+			PRINS:              prinsContext,
+		}, nil
+	}
+
+	n32fContextID, err := prins.ContextID(state)
+	if err != nil {
+		// Without PRINS no keys depend on the TLS session, a random
+		// identifier only known locally is enough.
+		n32fContextID, err = randomContextID()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &model.N32fContext{
+		N32fContextID:      n32fContextID,
+		RemoteN32FQDN:      remoteN32FQDN,
+		SecurityCapability: capability,
+	}, nil
+}
+
+// N32fTargetURL returns the URL a remote SEPP advertising senderN32fFqdn
+// and senderN32fPortList wants N32-f traffic to be sent to, or an empty
+// string when it did not advertise any.
+func N32fTargetURL(senderN32fFqdn model.FQDN, senderN32fPortList []int) string {
+	if senderN32fFqdn == "" {
+		return ""
+	}
+	host := string(senderN32fFqdn)
+	if len(senderN32fPortList) > 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(senderN32fPortList[0]))
+	}
+	return "https://" + host
+}
+
+func randomContextID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
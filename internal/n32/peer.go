@@ -0,0 +1,153 @@
+package n32
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/internal/model"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// MaxConcurrentStreams is advertised by the N32 and SBI servers. Peers
+	// open another connection once it is reached.
+	MaxConcurrentStreams = 1000
+
+	peerMaxIdleConnsPerHost = 8
+	peerIdleConnTimeout     = 90 * time.Second
+	peerTLSHandshakeTimeout = 10 * time.Second
+	peerReadIdleTimeout     = 30 * time.Second
+	peerPingTimeout         = 15 * time.Second
+)
+
+// Peer holds the connections to a remote SEPP. Its transport is shared
+// by the N32-c handshakes and the N32-f traffic so that TLS sessions
+// are established once and reused.
+type Peer struct {
+	RemoteSEPP model.RemoteSEPP
+	Transport  *http.Transport
+	Client     *Client
+
+	store *certs.Store
+}
+
+// PeerManager owns one peer per remote SEPP, keyed by its URL. Peers are
+// added and removed as roaming partners are configured.
+type PeerManager struct {
+	watcher *certs.Watcher
+	logger  *log.Logger
+	mu      sync.RWMutex
+	peers   map[string]*Peer
+}
+
+// NewPeerManager returns the peers of remoteSEPPs, authenticating with
+// the material loaded by watcher so that it follows certificate renewals.
+func NewPeerManager(remoteSEPPs []model.RemoteSEPP, watcher *certs.Watcher, logger *log.Logger) (*PeerManager, error) {
+	m := &PeerManager{watcher: watcher, logger: logger, peers: make(map[string]*Peer, len(remoteSEPPs))}
+	for _, remoteSEPP := range remoteSEPPs {
+		peer, err := m.NewPeer(remoteSEPP)
+		if err != nil {
+			return nil, err
+		}
+		m.peers[remoteSEPP.URL] = peer
+	}
+	return m, nil
+}
+
+// NewPeer prepares the peer of remoteSEPP. It is only used once passed
+// to Add, or must be given to Discard.
+func (m *PeerManager) NewPeer(remoteSEPP model.RemoteSEPP) (*Peer, error) {
+	store, err := m.watcher.Load(remoteSEPP.ClientCert, remoteSEPP.ClientKey, remoteSEPP.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS material for remote SEPP %s: %w", remoteSEPP.URL, err)
+	}
+	transport, err := newPeerTransport(remoteSEPP, store)
+	if err != nil {
+		m.watcher.Release(store)
+		return nil, err
+	}
+	return &Peer{
+		RemoteSEPP: remoteSEPP,
+		Transport:  transport,
+		Client:     NewClient(transport, m.logger),
+		store:      store,
+	}, nil
+}
+
+// Add makes peer the one of its remote SEPP, replacing the previous one.
+func (m *PeerManager) Add(peer *Peer) {
+	m.mu.Lock()
+	previous, ok := m.peers[peer.RemoteSEPP.URL]
+	m.peers[peer.RemoteSEPP.URL] = peer
+	m.mu.Unlock()
+	if ok {
+		m.Discard(previous)
+	}
+}
+
+// Remove drops the peer of the remote SEPP reachable at url.
+func (m *PeerManager) Remove(url string) {
+	m.mu.Lock()
+	peer, ok := m.peers[url]
+	delete(m.peers, url)
+	m.mu.Unlock()
+	if ok {
+		m.Discard(peer)
+	}
+}
+
+// Discard closes the idle connections of a peer no longer in use and
+// stops watching its TLS material. Requests in flight complete.
+func (m *PeerManager) Discard(peer *Peer) {
+	peer.Transport.CloseIdleConnections()
+	m.watcher.Release(peer.store)
+}
+
+// Get returns the peer of the remote SEPP reachable at url.
+func (m *PeerManager) Get(url string) (*Peer, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	peer, ok := m.peers[url]
+	return peer, ok
+}
+
+// CloseIdleConnections closes the idle connections to every remote SEPP.
+func (m *PeerManager) CloseIdleConnections() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, peer := range m.peers {
+		peer.Transport.CloseIdleConnections()
+	}
+}
+
+// newPeerTransport returns an HTTP/2 transport authenticating the local
+// SEPP towards remoteSEPP. Idle connections are kept open and probed
+// with pings so that a dead interconnect is detected before it is used.
+func newPeerTransport(remoteSEPP model.RemoteSEPP, store *certs.Store) (*http.Transport, error) {
+	dialTLS := store.DialTLSContext("h2", "http/1.1")
+	transport := &http.Transport{
+		// The TLS connection is established by the transport so that
+		// the server is verified against the host dialed.
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, peerTLSHandshakeTimeout)
+			defer cancel()
+			return dialTLS(ctx, network, addr)
+		},
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: peerMaxIdleConnsPerHost,
+		IdleConnTimeout:     peerIdleConnTimeout,
+	}
+	h2Transport, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP/2 for remote SEPP %s: %w", remoteSEPP.URL, err)
+	}
+	h2Transport.ReadIdleTimeout = peerReadIdleTimeout
+	h2Transport.PingTimeout = peerPingTimeout
+	return transport, nil
+}
@@ -0,0 +1,133 @@
+package n32_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+)
+
+// writeClientCertificate writes a self-signed client certificate and
+// its key to dir.
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sepp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestGivenPeerWhenSendingSeveralRequestsThenOneHTTP2ConnectionIsUsed(t *testing.T) {
+	var connections atomic.Int32
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("Remote SEPP received %s request", r.Proto)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	remote.EnableHTTP2 = true
+	remote.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	remote.StartTLS()
+	defer remote.Close()
+
+	dir := t.TempDir()
+	certPath, keyPath := writeClientCertificate(t, dir)
+	caPath := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: remote.Certificate().Raw}), 0o600); err != nil {
+		t.Fatalf("Failed to write CA certificate: %v", err)
+	}
+	peers, err := n32.NewPeerManager([]model.RemoteSEPP{{URL: remote.URL, ClientCert: certPath, ClientKey: keyPath, CA: caPath}}, certs.NewWatcher(log.Default()), log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create peer manager: %v", err)
+	}
+	peer, ok := peers.Get(remote.URL)
+	if !ok {
+		t.Fatalf("Expected a peer for %s", remote.URL)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := peer.Client.POSTN32fError(context.Background(), remote.URL, n32.N32fErrorInfo{N32fMessageId: "1", N32fErrorType: n32.ErrorTypeIntegrityCheckFailed}); err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+	}
+
+	if connections.Load() != 1 {
+		t.Errorf("Expected 1 connection to the remote SEPP, got %d", connections.Load())
+	}
+}
+
+func TestGivenMissingCertificateWhenNewPeerManagerThenErrorIsReturned(t *testing.T) {
+	_, err := n32.NewPeerManager([]model.RemoteSEPP{{URL: "https://remote-sepp.example.com", ClientCert: "missing.crt", ClientKey: "missing.key", CA: "missing.crt"}}, certs.NewWatcher(log.Default()), log.Default())
+
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestGivenRemovedPeerWhenGetThenNoPeerIsReturned(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeClientCertificate(t, dir)
+	remoteSEPP := model.RemoteSEPP{URL: "https://remote-sepp.example.com", ClientCert: certPath, ClientKey: keyPath, CA: certPath}
+	peers, err := n32.NewPeerManager(nil, certs.NewWatcher(log.Default()), log.Default())
+	if err != nil {
+		t.Fatalf("Failed to create peer manager: %v", err)
+	}
+	peer, err := peers.NewPeer(remoteSEPP)
+	if err != nil {
+		t.Fatalf("Failed to create peer: %v", err)
+	}
+	peers.Add(peer)
+	if got, ok := peers.Get(remoteSEPP.URL); !ok || got != peer {
+		t.Fatalf("Expected the added peer to be returned")
+	}
+
+	peers.Remove(remoteSEPP.URL)
+
+	if _, ok := peers.Get(remoteSEPP.URL); ok {
+		t.Errorf("Expected no peer once removed")
+	}
+}
@@ -2,68 +2,150 @@ package n32
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
-	"slices"
 
 	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/problem"
 )
 
 type SecNegotiateReqData struct {
-	Sender                     model.FQDN
-	SupportedSecCapabilityList []model.SecurityCapability
+	Sender                            model.FQDN                 `json:"sender"`
+	SupportedSecCapabilityList        []model.SecurityCapability `json:"supportedSecCapabilityList"`
+	ThreeGppSbiTargetApiRootSupported bool                       `json:"3GppSbiTargetApiRootSupported,omitempty"`
+	PlmnIdList                        []model.PlmnId             `json:"plmnIdList,omitempty"`
+	SnpnIdList                        []model.PlmnIdNid          `json:"snpnIdList,omitempty"`
+	TargetPlmnId                      *model.PlmnId              `json:"targetPlmnId,omitempty"`
+	TargetSnpnId                      *model.PlmnIdNid           `json:"targetSnpnId,omitempty"`
+	IntendedUsagePurpose              []model.IntendedN32Purpose `json:"intendedUsagePurpose,omitempty"`
+	SupportedFeatures                 model.SupportedFeatures    `json:"supportedFeatures,omitempty"`
+	SenderN32fFqdn                    model.FQDN                 `json:"senderN32fFqdn,omitempty"`
+	SenderN32fPortList                []int                      `json:"senderN32fPortList,omitempty"`
 }
 
 type SecNegotiateRspData struct {
-	Sender                model.FQDN
-	SelectedSecCapability model.SecurityCapability
+	Sender                            model.FQDN                 `json:"sender"`
+	SelectedSecCapability             model.SecurityCapability   `json:"selectedSecCapability"`
+	ThreeGppSbiTargetApiRootSupported bool                       `json:"3GppSbiTargetApiRootSupported,omitempty"`
+	PlmnIdList                        []model.PlmnId             `json:"plmnIdList,omitempty"`
+	SnpnIdList                        []model.PlmnIdNid          `json:"snpnIdList,omitempty"`
+	AllowedUsagePurpose               []model.IntendedN32Purpose `json:"allowedUsagePurpose,omitempty"`
+	RejectedUsagePurpose              []model.IntendedN32Purpose `json:"rejectedUsagePurpose,omitempty"`
+	SupportedFeatures                 model.SupportedFeatures    `json:"supportedFeatures,omitempty"`
+	SenderN32fFqdn                    model.FQDN                 `json:"senderN32fFqdn,omitempty"`
+	SenderN32fPortList                []int                      `json:"senderN32fPortList,omitempty"`
+}
+
+// validate checks the mandatory and conditional IEs of the request
+// as defined in TS 29.573 clause 6.1.5.2.2. It returns the application
+// error cause along with every offending attribute.
+func (reqData *SecNegotiateReqData) validate() (string, []model.InvalidParam) {
+	var missing, incorrect []model.InvalidParam
+	if reqData.Sender == "" {
+		missing = append(missing, model.InvalidParam{Param: "/sender", Reason: "sender is required"})
+	}
+	if len(reqData.SupportedSecCapabilityList) == 0 {
+		missing = append(missing, model.InvalidParam{Param: "/supportedSecCapabilityList", Reason: "supportedSecCapabilityList is required"})
+	}
+	for i, plmnId := range reqData.PlmnIdList {
+		if err := plmnId.Validate(); err != nil {
+			incorrect = append(incorrect, model.InvalidParam{Param: fmt.Sprintf("/plmnIdList/%d", i), Reason: err.Error()})
+		}
+	}
+	for i, snpnId := range reqData.SnpnIdList {
+		if err := snpnId.Validate(); err != nil {
+			incorrect = append(incorrect, model.InvalidParam{Param: fmt.Sprintf("/snpnIdList/%d", i), Reason: err.Error()})
+		}
+	}
+	if reqData.TargetPlmnId != nil {
+		if err := reqData.TargetPlmnId.Validate(); err != nil {
+			incorrect = append(incorrect, model.InvalidParam{Param: "/targetPlmnId", Reason: err.Error()})
+		}
+	}
+	if reqData.TargetSnpnId != nil {
+		if err := reqData.TargetSnpnId.Validate(); err != nil {
+			incorrect = append(incorrect, model.InvalidParam{Param: "/targetSnpnId", Reason: err.Error()})
+		}
+	}
+	for i, purpose := range reqData.IntendedUsagePurpose {
+		if purpose.UsagePurpose == "" {
+			incorrect = append(incorrect, model.InvalidParam{Param: fmt.Sprintf("/intendedUsagePurpose/%d/usagePurpose", i), Reason: "usagePurpose is required"})
+		}
+	}
+	if err := reqData.SupportedFeatures.Validate(); err != nil {
+		incorrect = append(incorrect, model.InvalidParam{Param: "/supportedFeatures", Reason: err.Error()})
+	}
+	if len(reqData.SenderN32fPortList) > 0 && reqData.SenderN32fFqdn == "" {
+		incorrect = append(incorrect, model.InvalidParam{Param: "/senderN32fFqdn", Reason: "senderN32fFqdn is required with senderN32fPortList"})
+	}
+	for i, port := range reqData.SenderN32fPortList {
+		if port < 1 || port > 65535 {
+			incorrect = append(incorrect, model.InvalidParam{Param: fmt.Sprintf("/senderN32fPortList/%d", i), Reason: fmt.Sprintf("invalid port %d", port)})
+		}
+	}
+	if len(missing) > 0 {
+		return model.CauseMandatoryIeMissing, append(missing, incorrect...)
+	}
+	if len(incorrect) > 0 {
+		return model.CauseOptionalIeIncorrect, incorrect
+	}
+	return "", nil
 }
 
 func HandlePostExchangeCapability(w http.ResponseWriter, r *http.Request, seppContext *model.SEPPContext) {
 	reqData := new(SecNegotiateReqData)
 
 	if err := json.NewDecoder(r.Body).Decode(reqData); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		log.Printf("N32 server - invalid request body: %v", err)
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid request body")
+		seppContext.Logger().Printf("N32 server - invalid request body: %v", err)
 		return
 	}
 
-	if reqData.Sender == "" {
-		http.Error(w, "Sender is required", http.StatusBadRequest)
-		log.Printf("N32 server - sender is required")
+	if cause, invalidParams := reqData.validate(); cause != "" {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, cause, "Invalid SecNegotiateReqData", invalidParams...)
+		seppContext.Logger().Printf("N32 server - invalid SecNegotiateReqData: %s %v", cause, invalidParams)
 		return
 	}
 
-	if len(reqData.SupportedSecCapabilityList) == 0 {
-		http.Error(w, "SupportedSecCapabilityList is required", http.StatusBadRequest)
-		log.Printf("N32 server - supportedSecCapabilityList is required")
+	settings := seppContext.Settings()
+	remoteSEPP, invalidParams := verifySender(r.TLS, reqData.Sender, reqData.PlmnIdList, settings)
+	if len(invalidParams) > 0 {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseMandatoryIeIncorrect, "Sender is not authenticated by the client certificate", invalidParams...)
+		seppContext.Logger().Printf("N32 server - rejected exchange-capability from %s: %v", reqData.Sender, invalidParams)
 		return
 	}
 
-	containsSupportedCapability := slices.Contains(reqData.SupportedSecCapabilityList, seppContext.SupportedSecurityCapability)
-	if !containsSupportedCapability {
-		http.Error(w, "Bad SecurityCapability", http.StatusBadRequest)
-		log.Printf("N32 server - bad SecurityCapability - Only %s is supported", seppContext.SupportedSecurityCapability)
+	supportedSecurityCapabilities := settings.SupportedSecurityCapabilities
+	selectedCapability, ok := model.SelectSecurityCapability(supportedSecurityCapabilities, reqData.SupportedSecCapabilityList)
+	if !ok {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseUnsupportedSecurityCapability, fmt.Sprintf("Supported security capabilities are %v", supportedSecurityCapabilities))
+		seppContext.Logger().Printf("N32 server - bad SecurityCapability - none of %v is supported", reqData.SupportedSecCapabilityList)
+		return
+	}
+
+	// The context is keyed by the configured URL, which the SBI proxy
+	// and the reloads look it up by.
+	n32fContext, err := NewN32fContext(r.TLS, model.FQDN(remoteSEPP.URL), selectedCapability, false, seppContext)
+	if err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusInternalServerError, model.CauseSystemFailure, "Failed to establish N32-f context")
+		seppContext.Logger().Printf("N32 server - failed to establish N32-f context: %v", err)
 		return
 	}
+	n32fContext.RemoteN32fURL = N32fTargetURL(reqData.SenderN32fFqdn, reqData.SenderN32fPortList)
 
 	rspData := SecNegotiateRspData{
-		Sender:                seppContext.LocalN32FQDN,
-		SelectedSecCapability: seppContext.SupportedSecurityCapability,
+		Sender:                settings.LocalN32FQDN,
+		SelectedSecCapability: selectedCapability,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(rspData)
+	err = json.NewEncoder(w).Encode(rspData)
 	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		log.Printf("N32 server - failed to encode response: %v", err)
+		seppContext.Logger().Printf("N32 server - failed to encode response: %v", err)
 		return
 	}
 
-	seppContext.Mu.Lock()
-	seppContext.RemoteN32FQDN = reqData.Sender
-	seppContext.SelectedSecurityCapability = rspData.SelectedSecCapability
-	seppContext.Mu.Unlock()
-	log.Printf("N32 server - successfully exchanged capability %s with remote SEPP %s", rspData.SelectedSecCapability, reqData.Sender)
+	seppContext.AddN32fContext(n32fContext)
+	seppContext.Logger().Printf("N32 server - successfully exchanged capability %s with remote SEPP %s, N32-f context %s", rspData.SelectedSecCapability, remoteSEPP.URL, n32fContext.N32fContextID)
 }
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"sync"
+	"reflect"
 	"testing"
 
 	"github.com/dot-5g/sepp/internal/model"
@@ -14,15 +14,14 @@ import (
 
 func TestGivenSupportedCapabilityWhenHandlePostExchangeCapabilityThenReturns200(t *testing.T) {
 	localFQDN := "local-sepp.example.com"
-	seppContext := &model.SEPPContext{
-		Mu:                          sync.Mutex{},
-		LocalN32FQDN:                model.FQDN(localFQDN),
-		RemoteN32FQDN:               model.FQDN(""),
-		SupportedSecurityCapability: model.SecurityCapability("TLS"),
-	}
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN(localFQDN),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
 
 	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
-		Sender:                     "testSender",
+		Sender:                     "remote-sepp.example.com",
 		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
 	})
 	if err != nil {
@@ -33,6 +32,7 @@ func TestGivenSupportedCapabilityWhenHandlePostExchangeCapabilityThenReturns200(
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
 	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
 
 	rr := httptest.NewRecorder()
 
@@ -53,20 +53,19 @@ func TestGivenSupportedCapabilityWhenHandlePostExchangeCapabilityThenReturns200(
 		t.Fatalf("Failed to unmarshal response body: %v", err)
 	}
 
-	if actualResponse != expectedResponse {
+	if !reflect.DeepEqual(actualResponse, expectedResponse) {
 		t.Errorf("Handler returned unexpected body:\nGot:  %+v\nWant: %+v", actualResponse, expectedResponse)
 	}
 }
 
 func TestGivenSupportedCapabilityWhenHandlePostExchangeCapabilityThenRemoteFQDNIsStored(t *testing.T) {
 	localFQDN := "local-sepp.example.com"
-	remoteFQDN := "remote-sepp.example.com"
-	seppContext := &model.SEPPContext{
-		Mu:                          sync.Mutex{},
-		LocalN32FQDN:                model.FQDN(localFQDN),
-		RemoteN32FQDN:               model.FQDN(""),
-		SupportedSecurityCapability: model.SecurityCapability("TLS"),
-	}
+	remoteFQDN := "https://remote-sepp.example.com"
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN(localFQDN),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
 
 	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
 		Sender:                     model.FQDN(remoteFQDN),
@@ -80,6 +79,7 @@ func TestGivenSupportedCapabilityWhenHandlePostExchangeCapabilityThenRemoteFQDNI
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
 	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
 
 	rr := httptest.NewRecorder()
 
@@ -89,21 +89,57 @@ func TestGivenSupportedCapabilityWhenHandlePostExchangeCapabilityThenRemoteFQDNI
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	if seppContext.RemoteN32FQDN != model.FQDN(remoteFQDN) {
-		t.Errorf("RemoteFQDN not stored: got %v want %v", seppContext.RemoteN32FQDN, remoteFQDN)
+	if _, ok := seppContext.GetPeerN32fContext(model.FQDN(remoteFQDN)); !ok {
+		t.Errorf("N32-f context with %v not stored", remoteFQDN)
+	}
+}
+
+func TestGivenSenderN32fFqdnWhenHandlePostExchangeCapabilityThenN32fTargetIsStored(t *testing.T) {
+	remoteFQDN := "https://remote-sepp.example.com"
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  "local-sepp.example.com",
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
+
+	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
+		Sender:                     model.FQDN(remoteFQDN),
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+		SenderN32fFqdn:             "n32f.remote-sepp.example.com",
+		SenderN32fPortList:         []int{8443},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+
+	n32fContext, ok := seppContext.GetPeerN32fContext(model.FQDN(remoteFQDN))
+	if !ok {
+		t.Fatalf("N32-f context with %v not stored", remoteFQDN)
+	}
+	if n32fContext.N32fURL() != "https://n32f.remote-sepp.example.com:8443" {
+		t.Errorf("Unexpected N32-f target %q", n32fContext.N32fURL())
 	}
 }
 
 func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenReturns4xx(t *testing.T) {
 	localFQDN := "local-sepp.example.com"
-	seppContext := &model.SEPPContext{
-		Mu:                          sync.Mutex{},
-		LocalN32FQDN:                model.FQDN(localFQDN),
-		RemoteN32FQDN:               model.FQDN(""),
-		SupportedSecurityCapability: model.SecurityCapability("TLS"),
-	}
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN(localFQDN),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
 	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
-		Sender:                     "testSender",
+		Sender:                     "remote-sepp.example.com",
 		SupportedSecCapabilityList: []model.SecurityCapability{model.ALS},
 	})
 	if err != nil {
@@ -114,6 +150,7 @@ func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenReturns4x
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
 	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
 
 	rr := httptest.NewRecorder()
 
@@ -126,14 +163,13 @@ func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenReturns4x
 
 func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenRemoteFQDNNotStored(t *testing.T) {
 	localFQDN := "local-sepp.example.com"
-	seppContext := &model.SEPPContext{
-		Mu:                          sync.Mutex{},
-		LocalN32FQDN:                model.FQDN(localFQDN),
-		RemoteN32FQDN:               model.FQDN(""),
-		SupportedSecurityCapability: model.SecurityCapability("TLS"),
-	}
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN(localFQDN),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
 	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
-		Sender:                     "testSender",
+		Sender:                     "remote-sepp.example.com",
 		SupportedSecCapabilityList: []model.SecurityCapability{model.ALS},
 	})
 	if err != nil {
@@ -144,6 +180,41 @@ func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenRemoteFQD
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
 	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	if len(seppContext.N32fContexts) != 0 {
+		t.Errorf("N32-f context stored: %v", seppContext.N32fContexts)
+	}
+}
+
+func TestGivenInvalidPlmnIdWhenHandlePostExchangeCapabilityThenReturns400(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN("local-sepp.example.com"),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
+	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
+		Sender:                     "remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+		PlmnIdList:                 []model.PlmnId{{Mcc: "1", Mnc: "01"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
 
 	rr := httptest.NewRecorder()
 
@@ -152,8 +223,181 @@ func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenRemoteFQD
 	if status := rr.Code; status != http.StatusBadRequest {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
 	}
+}
+
+func TestGivenSpecCompliantRequestBodyWhenHandlePostExchangeCapabilityThenReturnsCamelCaseResponse(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN("local-sepp.example.com"),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
+	reqBody := `{
+		"sender": "remote-sepp.example.com",
+		"supportedSecCapabilityList": ["TLS"],
+		"3GppSbiTargetApiRootSupported": true,
+		"plmnIdList": [{"mcc": "001", "mnc": "01"}],
+		"targetPlmnId": {"mcc": "002", "mnc": "002"},
+		"intendedUsagePurpose": [{"usagePurpose": "ROAMING"}],
+		"supportedFeatures": "1A",
+		"senderN32fFqdn": "n32f.remote-sepp.example.com",
+		"senderN32fPortList": [443]
+	}`
+
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBufferString(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var actualResponse map[string]interface{}
+	err = json.Unmarshal(rr.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if actualResponse["sender"] != "local-sepp.example.com" {
+		t.Errorf("Expected sender 'local-sepp.example.com', got '%v'", actualResponse["sender"])
+	}
+
+	if actualResponse["selectedSecCapability"] != "TLS" {
+		t.Errorf("Expected selectedSecCapability 'TLS', got '%v'", actualResponse["selectedSecCapability"])
+	}
+
+	if _, ok := seppContext.GetPeerN32fContext(model.FQDN("https://remote-sepp.example.com")); !ok {
+		t.Errorf("N32-f context with %v not stored", "https://remote-sepp.example.com")
+	}
+}
+
+func TestGivenUnsupportedCapabilityWhenHandlePostExchangeCapabilityThenReturnsProblemDetails(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN("local-sepp.example.com"),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
+	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
+		Sender:                     "remote-sepp.example.com",
+		SupportedSecCapabilityList: []model.SecurityCapability{model.ALS},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("Handler returned wrong content type: got %v want %v", contentType, "application/problem+json")
+	}
+
+	var problemDetails model.ProblemDetails
+	err = json.Unmarshal(rr.Body.Bytes(), &problemDetails)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if problemDetails.Status != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, problemDetails.Status)
+	}
+
+	if problemDetails.Cause != model.CauseUnsupportedSecurityCapability {
+		t.Errorf("Expected cause '%s', got '%s'", model.CauseUnsupportedSecurityCapability, problemDetails.Cause)
+	}
+}
+
+func TestGivenMissingSenderWhenHandlePostExchangeCapabilityThenReturnsMandatoryIeMissing(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN("local-sepp.example.com"),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.TLS},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
+	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
+		SupportedSecCapabilityList: []model.SecurityCapability{model.TLS},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+
+	var problemDetails model.ProblemDetails
+	err = json.Unmarshal(rr.Body.Bytes(), &problemDetails)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if problemDetails.Cause != model.CauseMandatoryIeMissing {
+		t.Errorf("Expected cause '%s', got '%s'", model.CauseMandatoryIeMissing, problemDetails.Cause)
+	}
+
+	if len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != "/sender" {
+		t.Errorf("Expected invalid param '/sender', got %+v", problemDetails.InvalidParams)
+	}
+}
+
+func TestGivenSeveralMutualCapabilitiesWhenHandlePostExchangeCapabilityThenMostPreferredIsSelected(t *testing.T) {
+	remoteFQDN := "https://remote-sepp.example.com"
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:                  model.FQDN("local-sepp.example.com"),
+		SupportedSecurityCapabilities: []model.SecurityCapability{model.PRINS, model.TLS, model.NONE},
+		RemoteSEPPs:                   remoteSEPPs,
+	})
+	reqBody, err := json.Marshal(n32.SecNegotiateReqData{
+		Sender:                     model.FQDN(remoteFQDN),
+		SupportedSecCapabilityList: []model.SecurityCapability{model.NONE, model.TLS},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-capability", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+
+	rr := httptest.NewRecorder()
+
+	n32.HandlePostExchangeCapability(rr, req, seppContext)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var actualResponse n32.SecNegotiateRspData
+	err = json.Unmarshal(rr.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	if actualResponse.SelectedSecCapability != model.TLS {
+		t.Errorf("Expected selected capability %s, got %s", model.TLS, actualResponse.SelectedSecCapability)
+	}
 
-	if seppContext.RemoteN32FQDN != model.FQDN("") {
-		t.Errorf("RemoteFQDN stored: got %v want %v", seppContext.RemoteN32FQDN, "")
+	n32fContext, ok := seppContext.GetPeerN32fContext(model.FQDN(remoteFQDN))
+	if !ok || n32fContext.SecurityCapability != model.TLS {
+		t.Errorf("Selected capability not recorded for peer: got %+v want %v", n32fContext, model.TLS)
 	}
 }
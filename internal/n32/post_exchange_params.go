@@ -0,0 +1,160 @@
+package n32
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/prins"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+type SecParamExchReqData struct {
+	N32fContextId                     string                      `json:"n32fContextId"`
+	JweCipherSuiteList                []string                    `json:"jweCipherSuiteList,omitempty"`
+	JwsCipherSuiteList                []string                    `json:"jwsCipherSuiteList,omitempty"`
+	ProtectionPolicyInfo              *model.ProtectionPolicy     `json:"protectionPolicyInfo,omitempty"`
+	ThreeGppSbiTargetApiRootSupported bool                        `json:"3GppSbiTargetApiRootSupported,omitempty"`
+	IpxProviderSecInfoList            *[]model.IpxProviderSecInfo `json:"ipxProviderSecInfoList,omitempty"`
+	Sender                            model.FQDN                  `json:"sender,omitempty"`
+}
+
+type SecParamExchRspData struct {
+	N32fContextId                     string                      `json:"n32fContextId"`
+	SelectedJweCipherSuite            string                      `json:"selectedJweCipherSuite,omitempty"`
+	SelectedJwsCipherSuite            string                      `json:"selectedJwsCipherSuite,omitempty"`
+	SelProtectionPolicyInfo           *model.ProtectionPolicy     `json:"selProtectionPolicyInfo,omitempty"`
+	ThreeGppSbiTargetApiRootSupported bool                        `json:"3GppSbiTargetApiRootSupported,omitempty"`
+	IpxProviderSecInfoList            *[]model.IpxProviderSecInfo `json:"ipxProviderSecInfoList,omitempty"`
+	Sender                            model.FQDN                  `json:"sender,omitempty"`
+}
+
+// validate checks the request of one of the three parameter exchange
+// procedures of TS 29.573 clause 5.2.3.3: cipher suite negotiation,
+// protection policy exchange or IPX security information exchange.
+func (reqData *SecParamExchReqData) validate() (string, []model.InvalidParam) {
+	if reqData.N32fContextId == "" {
+		return model.CauseMandatoryIeMissing, []model.InvalidParam{{Param: "/n32fContextId", Reason: "n32fContextId is required"}}
+	}
+	cipherSuites := len(reqData.JweCipherSuiteList) > 0 || len(reqData.JwsCipherSuiteList) > 0
+	if !cipherSuites && reqData.ProtectionPolicyInfo == nil && reqData.IpxProviderSecInfoList == nil {
+		return model.CauseMandatoryIeMissing, []model.InvalidParam{{Param: "/", Reason: "one of jweCipherSuiteList, jwsCipherSuiteList, protectionPolicyInfo or ipxProviderSecInfoList is required"}}
+	}
+	var invalidParams []model.InvalidParam
+	if reqData.ProtectionPolicyInfo != nil {
+		for i, mapping := range reqData.ProtectionPolicyInfo.ApiIeMappingList {
+			if mapping.ApiSignature.Uri == "" && mapping.ApiSignature.CApiSignature == "" {
+				invalidParams = append(invalidParams, model.InvalidParam{Param: fmt.Sprintf("/protectionPolicyInfo/apiIeMappingList/%d/apiSignature", i), Reason: "apiSignature is required"})
+			}
+			if mapping.ApiMethod == "" {
+				invalidParams = append(invalidParams, model.InvalidParam{Param: fmt.Sprintf("/protectionPolicyInfo/apiIeMappingList/%d/apiMethod", i), Reason: "apiMethod is required"})
+			}
+		}
+	}
+	if reqData.IpxProviderSecInfoList != nil {
+		for i, ipxProvider := range *reqData.IpxProviderSecInfoList {
+			if ipxProvider.IpxProviderId == "" {
+				invalidParams = append(invalidParams, model.InvalidParam{Param: fmt.Sprintf("/ipxProviderSecInfoList/%d/ipxProviderId", i), Reason: "ipxProviderId is required"})
+			}
+		}
+	}
+	if len(invalidParams) > 0 {
+		return model.CauseMandatoryIeIncorrect, invalidParams
+	}
+	return "", nil
+}
+
+func HandlePostExchangeParams(w http.ResponseWriter, r *http.Request, seppContext *model.SEPPContext) {
+	reqData := new(SecParamExchReqData)
+
+	if err := json.NewDecoder(r.Body).Decode(reqData); err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid request body")
+		seppContext.Logger().Printf("N32 server - invalid request body: %v", err)
+		return
+	}
+
+	if cause, invalidParams := reqData.validate(); cause != "" {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, cause, "Invalid SecParamExchReqData", invalidParams...)
+		seppContext.Logger().Printf("N32 server - invalid SecParamExchReqData: %s %v", cause, invalidParams)
+		return
+	}
+
+	prinsContext, ok := seppContext.GetPRINSContext(reqData.N32fContextId)
+	if !ok {
+		problem.Write(w, seppContext.Logger(), http.StatusNotFound, model.CauseContextNotFound, "Unknown N32-f context")
+		seppContext.Logger().Printf("N32 server - unknown N32-f context %s", reqData.N32fContextId)
+		return
+	}
+
+	settings := seppContext.Settings()
+	if reqData.Sender != "" && !isSender(settings, reqData.Sender, prinsContext.RemoteN32FQDN) {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseContextNotFound, "N32-f context belongs to another SEPP")
+		seppContext.Logger().Printf("N32 server - %s attempted to update N32-f context of %s", reqData.Sender, prinsContext.RemoteN32FQDN)
+		return
+	}
+
+	if err := verifyPeer(r.TLS, prinsContext.RemoteN32FQDN); err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseContextNotFound, "N32-f context belongs to another SEPP")
+		seppContext.Logger().Printf("N32 server - rejected update of N32-f context of %s: %v", prinsContext.RemoteN32FQDN, err)
+		return
+	}
+
+	rspData := SecParamExchRspData{
+		N32fContextId: reqData.N32fContextId,
+		Sender:        settings.LocalN32FQDN,
+	}
+
+	if len(reqData.JweCipherSuiteList) > 0 {
+		cipherSuite, ok := prins.SelectCipherSuite(settings.JweCipherSuites, reqData.JweCipherSuiteList)
+		if !ok {
+			problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseUnsupportedCipherSuite, fmt.Sprintf("Supported JWE cipher suites are %v", settings.JweCipherSuites))
+			seppContext.Logger().Printf("N32 server - none of JWE cipher suites %v is supported", reqData.JweCipherSuiteList)
+			return
+		}
+		rspData.SelectedJweCipherSuite = cipherSuite
+	}
+
+	if len(reqData.JwsCipherSuiteList) > 0 {
+		cipherSuite, ok := prins.SelectCipherSuite(settings.JwsCipherSuites, reqData.JwsCipherSuiteList)
+		if !ok {
+			problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseUnsupportedCipherSuite, fmt.Sprintf("Supported JWS cipher suites are %v", settings.JwsCipherSuites))
+			seppContext.Logger().Printf("N32 server - none of JWS cipher suites %v is supported", reqData.JwsCipherSuiteList)
+			return
+		}
+		rspData.SelectedJwsCipherSuite = cipherSuite
+	}
+
+	if reqData.ProtectionPolicyInfo != nil {
+		localPolicy := settings.ProtectionPolicy
+		rspData.SelProtectionPolicyInfo = &localPolicy
+	}
+
+	if reqData.IpxProviderSecInfoList != nil {
+		localIpxProviders := append([]model.IpxProviderSecInfo{}, settings.IpxProviderSecInfoList...)
+		rspData.IpxProviderSecInfoList = &localIpxProviders
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rspData); err != nil {
+		seppContext.Logger().Printf("N32 server - failed to encode response: %v", err)
+		return
+	}
+
+	seppContext.UpdatePRINSContext(reqData.N32fContextId, func(prinsContext *model.PRINSContext) {
+		if rspData.SelectedJweCipherSuite != "" {
+			prinsContext.JweCipherSuite = rspData.SelectedJweCipherSuite
+		}
+		if rspData.SelectedJwsCipherSuite != "" {
+			prinsContext.JwsCipherSuite = rspData.SelectedJwsCipherSuite
+		}
+		if reqData.ProtectionPolicyInfo != nil {
+			prinsContext.ProtectionPolicy = prins.MergeProtectionPolicies(settings.ProtectionPolicy, *reqData.ProtectionPolicyInfo)
+		}
+		if reqData.IpxProviderSecInfoList != nil {
+			prinsContext.RemoteIpxProviderSecInfoList = *reqData.IpxProviderSecInfoList
+		}
+	})
+	seppContext.Logger().Printf("N32 server - successfully exchanged parameters of N32-f context %s with remote SEPP %s", reqData.N32fContextId, prinsContext.RemoteN32FQDN)
+}
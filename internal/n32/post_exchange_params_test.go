@@ -0,0 +1,166 @@
+package n32_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+func newParamsSEPPContext() *model.SEPPContext {
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalN32FQDN:    "local-sepp.example.com",
+		JweCipherSuites: []string{"A256GCM", "A128GCM"},
+		JwsCipherSuites: []string{"ES256"},
+		ProtectionPolicy: model.ProtectionPolicy{
+			DataTypeEncPolicy: []model.IeType{model.IeTypeUeId},
+		},
+		IpxProviderSecInfoList: []model.IpxProviderSecInfo{{IpxProviderId: "local-ipx.example.com"}},
+	})
+	seppContext.AddN32fContext(&model.N32fContext{
+		N32fContextID:      "0123456789abcdef",
+		RemoteN32FQDN:      "remote-sepp.example.com",
+		SecurityCapability: model.PRINS,
+		PRINS:              &model.PRINSContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "remote-sepp.example.com"},
+	})
+	return seppContext
+}
+
+func postExchangeParams(t *testing.T, seppContext *model.SEPPContext, reqData n32.SecParamExchReqData) *httptest.ResponseRecorder {
+	reqBody, err := json.Marshal(reqData)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/exchange-params", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+	rr := httptest.NewRecorder()
+	n32.HandlePostExchangeParams(rr, req, seppContext)
+	return rr
+}
+
+func TestGivenCipherSuiteListsWhenHandlePostExchangeParamsThenMostPreferredCommonSuitesAreSelected(t *testing.T) {
+	seppContext := newParamsSEPPContext()
+
+	rr := postExchangeParams(t, seppContext, n32.SecParamExchReqData{
+		N32fContextId:      "0123456789abcdef",
+		JweCipherSuiteList: []string{"A128GCM", "A256GCM"},
+		JwsCipherSuiteList: []string{"ES256"},
+		Sender:             "remote-sepp.example.com",
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var rspData n32.SecParamExchRspData
+	if err := json.Unmarshal(rr.Body.Bytes(), &rspData); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if rspData.SelectedJweCipherSuite != "A256GCM" || rspData.SelectedJwsCipherSuite != "ES256" {
+		t.Errorf("Unexpected selected cipher suites %s and %s", rspData.SelectedJweCipherSuite, rspData.SelectedJwsCipherSuite)
+	}
+	prinsContext, _ := seppContext.GetPRINSContext("0123456789abcdef")
+	if prinsContext.JweCipherSuite != "A256GCM" || prinsContext.JwsCipherSuite != "ES256" {
+		t.Errorf("Cipher suites were not stored in the N32-f context: %+v", prinsContext)
+	}
+}
+
+func TestGivenUnsupportedCipherSuiteWhenHandlePostExchangeParamsThenReturnsUnsupportedCipherSuite(t *testing.T) {
+	seppContext := newParamsSEPPContext()
+
+	rr := postExchangeParams(t, seppContext, n32.SecParamExchReqData{
+		N32fContextId:      "0123456789abcdef",
+		JweCipherSuiteList: []string{"A192GCM"},
+	})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	problemDetails := problem.Read(rr.Result())
+	if problemDetails.Cause != model.CauseUnsupportedCipherSuite {
+		t.Errorf("Expected cause %s, got %s", model.CauseUnsupportedCipherSuite, problemDetails.Cause)
+	}
+}
+
+func TestGivenProtectionPolicyWhenHandlePostExchangeParamsThenPoliciesAreMerged(t *testing.T) {
+	seppContext := newParamsSEPPContext()
+
+	rr := postExchangeParams(t, seppContext, n32.SecParamExchReqData{
+		N32fContextId:        "0123456789abcdef",
+		ProtectionPolicyInfo: &model.ProtectionPolicy{DataTypeEncPolicy: []model.IeType{model.IeTypeLocation}},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var rspData n32.SecParamExchRspData
+	if err := json.Unmarshal(rr.Body.Bytes(), &rspData); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if rspData.SelProtectionPolicyInfo == nil || len(rspData.SelProtectionPolicyInfo.DataTypeEncPolicy) != 1 || rspData.SelProtectionPolicyInfo.DataTypeEncPolicy[0] != model.IeTypeUeId {
+		t.Errorf("Expected local protection policy in response, got %+v", rspData.SelProtectionPolicyInfo)
+	}
+	prinsContext, _ := seppContext.GetPRINSContext("0123456789abcdef")
+	if len(prinsContext.ProtectionPolicy.DataTypeEncPolicy) != 2 {
+		t.Errorf("Expected merged data type encryption policy, got %v", prinsContext.ProtectionPolicy.DataTypeEncPolicy)
+	}
+}
+
+func TestGivenIpxProviderSecInfoListWhenHandlePostExchangeParamsThenListsAreExchanged(t *testing.T) {
+	seppContext := newParamsSEPPContext()
+	remoteIpxProviders := []model.IpxProviderSecInfo{{IpxProviderId: "remote-ipx.example.com", CertificateList: []string{"certificate"}}}
+
+	rr := postExchangeParams(t, seppContext, n32.SecParamExchReqData{
+		N32fContextId:          "0123456789abcdef",
+		IpxProviderSecInfoList: &remoteIpxProviders,
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var rspData n32.SecParamExchRspData
+	if err := json.Unmarshal(rr.Body.Bytes(), &rspData); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if rspData.IpxProviderSecInfoList == nil || len(*rspData.IpxProviderSecInfoList) != 1 || (*rspData.IpxProviderSecInfoList)[0].IpxProviderId != "local-ipx.example.com" {
+		t.Errorf("Expected local IPX providers in response, got %+v", rspData.IpxProviderSecInfoList)
+	}
+	prinsContext, _ := seppContext.GetPRINSContext("0123456789abcdef")
+	if len(prinsContext.RemoteIpxProviderSecInfoList) != 1 || prinsContext.RemoteIpxProviderSecInfoList[0].IpxProviderId != "remote-ipx.example.com" {
+		t.Errorf("Remote IPX providers were not stored: %+v", prinsContext.RemoteIpxProviderSecInfoList)
+	}
+}
+
+func TestGivenUnknownContextWhenHandlePostExchangeParamsThenReturns404(t *testing.T) {
+	seppContext := newParamsSEPPContext()
+
+	rr := postExchangeParams(t, seppContext, n32.SecParamExchReqData{
+		N32fContextId:      "fedcba9876543210",
+		JweCipherSuiteList: []string{"A256GCM"},
+	})
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGivenNoParametersWhenHandlePostExchangeParamsThenReturnsMandatoryIeMissing(t *testing.T) {
+	seppContext := newParamsSEPPContext()
+
+	rr := postExchangeParams(t, seppContext, n32.SecParamExchReqData{N32fContextId: "0123456789abcdef"})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	problemDetails := problem.Read(rr.Result())
+	if problemDetails.Cause != model.CauseMandatoryIeMissing {
+		t.Errorf("Expected cause %s, got %s", model.CauseMandatoryIeMissing, problemDetails.Cause)
+	}
+}
@@ -0,0 +1,94 @@
+package n32
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/prins"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+type N32fErrorType string
+
+const (
+	ErrorTypeIntegrityCheckFailed                = N32fErrorType("INTEGRITY_CHECK_FAILED")
+	ErrorTypeIntegrityCheckOnModificationsFailed = N32fErrorType("INTEGRITY_CHECK_ON_MODIFICATIONS_FAILED")
+	ErrorTypeMessageReconstructionFailed         = N32fErrorType("MESSAGE_RECONSTRUCTION_FAILED")
+	ErrorTypeContextNotFound                     = N32fErrorType("CONTEXT_NOT_FOUND")
+	ErrorTypePolicyMismatch                      = N32fErrorType("POLICY_MISMATCH")
+)
+
+type N32fErrorDetail struct {
+	Attribute                string `json:"attribute"`
+	MsgReconstructFailReason string `json:"msgReconstructFailReason"`
+}
+
+type N32fErrorInfo struct {
+	N32fMessageId    string            `json:"n32fMessageId"`
+	N32fErrorType    N32fErrorType     `json:"n32fErrorType"`
+	N32fContextId    string            `json:"n32fContextId,omitempty"`
+	ErrorDetailsList []N32fErrorDetail `json:"errorDetailsList,omitempty"`
+}
+
+// ErrorType returns the N32-f error type reported for a message that
+// failed to be unprotected with err.
+func ErrorType(err error) N32fErrorType {
+	switch {
+	case errors.Is(err, prins.ErrIntegrityCheckFailed):
+		return ErrorTypeIntegrityCheckFailed
+	case errors.Is(err, prins.ErrModificationsFailed):
+		return ErrorTypeIntegrityCheckOnModificationsFailed
+	case errors.Is(err, prins.ErrPolicyViolation):
+		return ErrorTypePolicyMismatch
+	case errors.Is(err, prins.ErrUnknownContext):
+		return ErrorTypeContextNotFound
+	default:
+		return ErrorTypeMessageReconstructionFailed
+	}
+}
+
+// HandlePostN32fError receives the report of a remote SEPP that one of
+// the N32-f messages sent to it, typically a response, was rejected.
+func HandlePostN32fError(w http.ResponseWriter, r *http.Request, seppContext *model.SEPPContext) {
+	reqData := new(N32fErrorInfo)
+
+	if err := json.NewDecoder(r.Body).Decode(reqData); err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid request body")
+		seppContext.Logger().Printf("N32 server - invalid request body: %v", err)
+		return
+	}
+
+	var invalidParams []model.InvalidParam
+	if reqData.N32fMessageId == "" {
+		invalidParams = append(invalidParams, model.InvalidParam{Param: "/n32fMessageId", Reason: "n32fMessageId is required"})
+	}
+	if reqData.N32fErrorType == "" {
+		invalidParams = append(invalidParams, model.InvalidParam{Param: "/n32fErrorType", Reason: "n32fErrorType is required"})
+	}
+	if len(invalidParams) > 0 {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseMandatoryIeMissing, "Invalid N32fErrorInfo", invalidParams...)
+		seppContext.Logger().Printf("N32 server - invalid N32fErrorInfo: %v", invalidParams)
+		return
+	}
+
+	remoteN32FQDN := model.FQDN("unknown")
+	if reqData.N32fContextId != "" {
+		n32fContext, ok := seppContext.GetN32fContext(reqData.N32fContextId)
+		if !ok {
+			problem.Write(w, seppContext.Logger(), http.StatusNotFound, model.CauseContextNotFound, "Unknown N32-f context")
+			seppContext.Logger().Printf("N32 server - unknown N32-f context %s", reqData.N32fContextId)
+			return
+		}
+		if err := verifyPeer(r.TLS, n32fContext.RemoteN32FQDN); err != nil {
+			problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseContextNotFound, "N32-f context belongs to another SEPP")
+			seppContext.Logger().Printf("N32 server - rejected N32-f error report on context of %s: %v", n32fContext.RemoteN32FQDN, err)
+			return
+		}
+		remoteN32FQDN = n32fContext.RemoteN32FQDN
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	seppContext.Logger().Printf("N32 server - remote SEPP %s rejected N32-f message %s of context %s: %s %v", remoteN32FQDN, reqData.N32fMessageId, reqData.N32fContextId, reqData.N32fErrorType, reqData.ErrorDetailsList)
+}
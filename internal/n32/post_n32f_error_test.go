@@ -0,0 +1,94 @@
+package n32_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/prins"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+func postN32fError(t *testing.T, seppContext *model.SEPPContext, state *tls.ConnectionState, reqData n32.N32fErrorInfo) *httptest.ResponseRecorder {
+	reqBody, err := json.Marshal(reqData)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/n32f-error", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = state
+	rr := httptest.NewRecorder()
+	n32.HandlePostN32fError(rr, req, seppContext)
+	return rr
+}
+
+func TestGivenKnownContextWhenHandlePostN32fErrorThenReturns204(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: model.PRINS})
+
+	rr := postN32fError(t, seppContext, peerTLS(t, "remote-sepp.example.com"), n32.N32fErrorInfo{
+		N32fMessageId: "message-1",
+		N32fErrorType: n32.ErrorTypeIntegrityCheckFailed,
+		N32fContextId: "0123456789abcdef",
+	})
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+}
+
+func TestGivenUnknownContextWhenHandlePostN32fErrorThenReturnsContextNotFound(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+
+	rr := postN32fError(t, seppContext, nil, n32.N32fErrorInfo{
+		N32fMessageId: "message-1",
+		N32fErrorType: n32.ErrorTypeIntegrityCheckFailed,
+		N32fContextId: "0123456789abcdef",
+	})
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if problemDetails := problem.Read(rr.Result()); problemDetails.Cause != model.CauseContextNotFound {
+		t.Errorf("Expected cause %s, got %s", model.CauseContextNotFound, problemDetails.Cause)
+	}
+}
+
+func TestGivenMissingErrorTypeWhenHandlePostN32fErrorThenReturnsMandatoryIeMissing(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+
+	rr := postN32fError(t, seppContext, nil, n32.N32fErrorInfo{N32fMessageId: "message-1"})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	problemDetails := problem.Read(rr.Result())
+	if problemDetails.Cause != model.CauseMandatoryIeMissing {
+		t.Errorf("Expected cause %s, got %s", model.CauseMandatoryIeMissing, problemDetails.Cause)
+	}
+	if len(problemDetails.InvalidParams) != 1 || problemDetails.InvalidParams[0].Param != "/n32fErrorType" {
+		t.Errorf("Expected invalid param /n32fErrorType, got %v", problemDetails.InvalidParams)
+	}
+}
+
+func TestGivenUnprotectErrorWhenErrorTypeThenMatchingN32fErrorTypeIsReturned(t *testing.T) {
+	cases := map[error]n32.N32fErrorType{
+		prins.ErrIntegrityCheckFailed: n32.ErrorTypeIntegrityCheckFailed,
+		prins.ErrModificationsFailed:  n32.ErrorTypeIntegrityCheckOnModificationsFailed,
+		prins.ErrPolicyViolation:      n32.ErrorTypePolicyMismatch,
+		prins.ErrInvalidMessage:       n32.ErrorTypeMessageReconstructionFailed,
+	}
+	for err, expected := range cases {
+		if errorType := n32.ErrorType(fmt.Errorf("wrapped: %w", err)); errorType != expected {
+			t.Errorf("Expected %s for %v, got %s", expected, err, errorType)
+		}
+	}
+}
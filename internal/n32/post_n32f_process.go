@@ -0,0 +1,102 @@
+package n32
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/prins"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+// responseRecorder buffers the response of the local handler so that
+// it can be reformatted before being sent back to the remote SEPP.
+type responseRecorder struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	return rr.body.Write(data)
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	rr.statusCode = statusCode
+}
+
+// HandlePostN32fProcess receives a PRINS protected request from the
+// remote SEPP, hands the recovered request to localHandler and returns
+// its response protected the same way.
+func HandlePostN32fProcess(w http.ResponseWriter, r *http.Request, seppContext *model.SEPPContext, localHandler http.Handler) {
+	reqMsg := new(prins.N32fReformattedReqMsg)
+	if err := json.NewDecoder(r.Body).Decode(reqMsg); err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid request body")
+		seppContext.Logger().Printf("N32 server - invalid request body: %v", err)
+		return
+	}
+
+	metaData, err := prins.PeekMetaData(reqMsg.ReformattedData)
+	if err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid reformatted data")
+		seppContext.Logger().Printf("N32 server - invalid reformatted data: %v", err)
+		return
+	}
+
+	prinsContext, ok := seppContext.GetPRINSContext(metaData.N32fContextId)
+	if !ok {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseContextNotFound, "Unknown N32-f context")
+		seppContext.Logger().Printf("N32 server - unknown N32-f context %s", metaData.N32fContextId)
+		return
+	}
+
+	// The request to the local NF is cancelled with the one of the
+	// remote SEPP.
+	request, _, err := prins.UnprotectRequest(r.Context(), reqMsg, prinsContext)
+	if errors.Is(err, prins.ErrIntegrityCheckFailed) {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseIntegrityCheckFailed, "Integrity check failed")
+		seppContext.Logger().Printf("N32 server - N32-f message %s rejected: %v", metaData.MessageId, err)
+		return
+	}
+	if errors.Is(err, prins.ErrModificationsFailed) {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseIntegrityCheckOnModificationsFailed, "Integrity check on modifications failed")
+		seppContext.Logger().Printf("N32 server - N32-f message %s rejected: %v", metaData.MessageId, err)
+		return
+	}
+	if errors.Is(err, prins.ErrPolicyViolation) {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CausePolicyMismatch, err.Error())
+		seppContext.Logger().Printf("N32 server - N32-f message %s rejected: %v", metaData.MessageId, err)
+		return
+	}
+	if err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid reformatted data")
+		seppContext.Logger().Printf("N32 server - N32-f message %s rejected: %v", metaData.MessageId, err)
+		return
+	}
+
+	recorder := newResponseRecorder()
+	localHandler.ServeHTTP(recorder, request)
+
+	rspMsg, err := prins.ProtectResponse(recorder.statusCode, recorder.header, recorder.body.Bytes(), request, prinsContext, metaData)
+	if err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusInternalServerError, model.CauseSystemFailure, "Failed to protect response")
+		seppContext.Logger().Printf("N32 server - failed to protect response to N32-f message %s: %v", metaData.MessageId, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rspMsg); err != nil {
+		seppContext.Logger().Printf("N32 server - failed to encode response: %v", err)
+	}
+}
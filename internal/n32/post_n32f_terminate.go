@@ -0,0 +1,54 @@
+package n32
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+type N32fContextInfo struct {
+	N32fContextId string `json:"n32fContextId"`
+}
+
+// HandlePostN32fTerminate deletes the N32-f context named by the remote
+// SEPP. Requests referring to it are rejected from then on.
+func HandlePostN32fTerminate(w http.ResponseWriter, r *http.Request, seppContext *model.SEPPContext) {
+	reqData := new(N32fContextInfo)
+
+	if err := json.NewDecoder(r.Body).Decode(reqData); err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseInvalidMsgFormat, "Invalid request body")
+		seppContext.Logger().Printf("N32 server - invalid request body: %v", err)
+		return
+	}
+
+	if reqData.N32fContextId == "" {
+		problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseMandatoryIeMissing, "Invalid N32fContextInfo", model.InvalidParam{Param: "/n32fContextId", Reason: "n32fContextId is required"})
+		seppContext.Logger().Printf("N32 server - invalid N32fContextInfo: missing n32fContextId")
+		return
+	}
+
+	n32fContext, ok := seppContext.GetN32fContext(reqData.N32fContextId)
+	if !ok {
+		problem.Write(w, seppContext.Logger(), http.StatusNotFound, model.CauseContextNotFound, "Unknown N32-f context")
+		seppContext.Logger().Printf("N32 server - unknown N32-f context %s", reqData.N32fContextId)
+		return
+	}
+
+	if err := verifyPeer(r.TLS, n32fContext.RemoteN32FQDN); err != nil {
+		problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseContextNotFound, "N32-f context belongs to another SEPP")
+		seppContext.Logger().Printf("N32 server - rejected termination of N32-f context of %s: %v", n32fContext.RemoteN32FQDN, err)
+		return
+	}
+
+	// The context may have been terminated concurrently, which is as good.
+	seppContext.RemoveN32fContext(reqData.N32fContextId)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(N32fContextInfo{N32fContextId: n32fContext.N32fContextID}); err != nil {
+		seppContext.Logger().Printf("N32 server - failed to encode response: %v", err)
+	}
+	seppContext.Logger().Printf("N32 server - terminated N32-f context %s with remote SEPP %s", n32fContext.N32fContextID, n32fContext.RemoteN32FQDN)
+}
@@ -0,0 +1,93 @@
+package n32_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+func postN32fTerminate(t *testing.T, seppContext *model.SEPPContext, reqData n32.N32fContextInfo) *httptest.ResponseRecorder {
+	reqBody, err := json.Marshal(reqData)
+	if err != nil {
+		t.Fatalf("Failed to marshal request body: %v", err)
+	}
+	req, err := http.NewRequest("POST", "/n32c-handshake/v1/n32f-terminate", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+	rr := httptest.NewRecorder()
+	n32.HandlePostN32fTerminate(rr, req, seppContext)
+	return rr
+}
+
+func TestGivenKnownContextWhenHandlePostN32fTerminateThenContextIsRemoved(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "remote-sepp.example.com", SecurityCapability: model.TLS})
+
+	rr := postN32fTerminate(t, seppContext, n32.N32fContextInfo{N32fContextId: "0123456789abcdef"})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var rspData n32.N32fContextInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &rspData); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if rspData.N32fContextId != "0123456789abcdef" {
+		t.Errorf("Expected n32fContextId '0123456789abcdef', got '%s'", rspData.N32fContextId)
+	}
+	if _, ok := seppContext.GetN32fContext("0123456789abcdef"); ok {
+		t.Errorf("N32-f context was not removed")
+	}
+	if _, ok := seppContext.GetPeerN32fContext("remote-sepp.example.com"); ok {
+		t.Errorf("Remote SEPP still has an N32-f context")
+	}
+}
+
+func TestGivenRemainingContextWhenHandlePostN32fTerminateThenOtherContextIsKept(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "remote-sepp.example.com", SecurityCapability: model.TLS})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "fedcba9876543210", RemoteN32FQDN: "remote-sepp.example.com", SecurityCapability: model.TLS})
+
+	rr := postN32fTerminate(t, seppContext, n32.N32fContextInfo{N32fContextId: "0123456789abcdef"})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if n32fContext, ok := seppContext.GetPeerN32fContext("remote-sepp.example.com"); !ok || n32fContext.N32fContextID != "fedcba9876543210" {
+		t.Errorf("Expected remaining N32-f context 'fedcba9876543210', got %+v", n32fContext)
+	}
+}
+
+func TestGivenUnknownContextWhenHandlePostN32fTerminateThenReturnsContextNotFound(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+
+	rr := postN32fTerminate(t, seppContext, n32.N32fContextInfo{N32fContextId: "0123456789abcdef"})
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if problemDetails := problem.Read(rr.Result()); problemDetails.Cause != model.CauseContextNotFound {
+		t.Errorf("Expected cause %s, got %s", model.CauseContextNotFound, problemDetails.Cause)
+	}
+}
+
+func TestGivenMissingContextIdWhenHandlePostN32fTerminateThenReturnsMandatoryIeMissing(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{LocalN32FQDN: "local-sepp.example.com"})
+
+	rr := postN32fTerminate(t, seppContext, n32.N32fContextInfo{})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if problemDetails := problem.Read(rr.Result()); problemDetails.Cause != model.CauseMandatoryIeMissing {
+		t.Errorf("Expected cause %s, got %s", model.CauseMandatoryIeMissing, problemDetails.Cause)
+	}
+}
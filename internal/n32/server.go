@@ -1,63 +1,105 @@
 package n32
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"os"
 
+	"github.com/dot-5g/sepp/internal/certs"
 	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/problem"
+	"golang.org/x/net/http2"
 )
 
-func loadClientCAs(caCertPath string) (*x509.CertPool, error) {
-	caCert, err := os.ReadFile(caCertPath)
-	if err != nil {
-		return nil, err
+func loggingMiddleware(logger *log.Logger, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Printf("N32 server - request received: %s %s", r.Method, r.URL.Path)
+		next(w, r)
+		logger.Printf("N32 server - request handled: %s %s", r.Method, r.URL.Path)
 	}
-
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
-	return caCertPool, nil
 }
 
-func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("N32 server - request received: %s %s", r.Method, r.URL.Path)
-		next(w, r)
-		log.Printf("N32 server - request handled: %s %s", r.Method, r.URL.Path)
+// HandleN32f receives the requests the remote SEPP forwards as is over a
+// TLS N32-f connection and hands them to localHandler. The client
+// certificate must identify a remote SEPP with which a context using TLS,
+// or no security at all, was negotiated. Requests protected by PRINS
+// only come through n32f-process.
+func HandleN32f(w http.ResponseWriter, r *http.Request, seppContext *model.SEPPContext, localHandler http.Handler) {
+	for _, n32fContext := range seppContext.ListN32fContexts() {
+		if n32fContext.SecurityCapability != model.PRINS && verifyPeer(r.TLS, n32fContext.RemoteN32FQDN) == nil {
+			localHandler.ServeHTTP(w, r)
+			return
+		}
 	}
+	problem.Write(w, seppContext.Logger(), http.StatusForbidden, model.CauseContextNotFound, "No N32-f context forwarding requests as is with this SEPP")
+	seppContext.Logger().Printf("N32 server - rejected %s %s: no N32-f context forwarding requests as is with the client", r.Method, r.URL.Path)
 }
 
-func HandleN32f(w http.ResponseWriter, r *http.Request) {
-	log.Printf("N32 server - request received: %s %s", r.Method, r.URL.Path)
-	w.WriteHeader(http.StatusOK)
-	log.Printf("N32 server - request handled: %s %s", r.Method, r.URL.Path)
+// Server serves the N32 interface until it is shut down.
+type Server struct {
+	logger     *log.Logger
+	httpServer *http.Server
 }
 
-func StartServer(address string, serverCertPath string, serverKeyPath string, caCertPath string, fqdn string, seppContext *model.SEPPContext) {
+// NewServer returns the N32 server, authenticating with the material of
+// store. Requests received from remote SEPPs are handed to localHandler
+// to reach the local NFs.
+func NewServer(address string, store *certs.Store, seppContext *model.SEPPContext, localHandler http.Handler) (*Server, error) {
+	logger := seppContext.Logger()
 	mux := http.NewServeMux()
-	mux.HandleFunc("/n32c-handshake/v1/exchange-capability", loggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/n32c-handshake/v1/exchange-capability", loggingMiddleware(logger, func(w http.ResponseWriter, r *http.Request) {
 		HandlePostExchangeCapability(w, r, seppContext)
 	}))
-	mux.HandleFunc("/", HandleN32f)
-	clientCAPool, err := loadClientCAs(caCertPath)
-	if err != nil {
-		log.Fatalf("failed to load client CA certificate: %s", err)
-	}
-
-	tlsConfig := &tls.Config{
-		ClientCAs:  clientCAPool,
-		ClientAuth: tls.RequireAndVerifyClientCert,
-	}
-	server := &http.Server{
+	mux.HandleFunc("/n32c-handshake/v1/exchange-params", loggingMiddleware(logger, func(w http.ResponseWriter, r *http.Request) {
+		HandlePostExchangeParams(w, r, seppContext)
+	}))
+	mux.HandleFunc("/n32c-handshake/v1/n32f-terminate", loggingMiddleware(logger, func(w http.ResponseWriter, r *http.Request) {
+		HandlePostN32fTerminate(w, r, seppContext)
+	}))
+	mux.HandleFunc("/n32c-handshake/v1/n32f-error", loggingMiddleware(logger, func(w http.ResponseWriter, r *http.Request) {
+		HandlePostN32fError(w, r, seppContext)
+	}))
+	mux.HandleFunc("/n32f-forward/v1/n32f-process", loggingMiddleware(logger, func(w http.ResponseWriter, r *http.Request) {
+		HandlePostN32fProcess(w, r, seppContext, localHandler)
+	}))
+	mux.HandleFunc("/", loggingMiddleware(logger, func(w http.ResponseWriter, r *http.Request) {
+		HandleN32f(w, r, seppContext, localHandler)
+	}))
+	httpServer := &http.Server{
 		Addr:      address,
 		Handler:   mux,
-		TLSConfig: tlsConfig,
+		TLSConfig: store.ServerTLSConfig(),
+		ErrorLog:  logger,
 	}
-	log.Printf("N32 server - started listening on %s", address)
-	if err := server.ListenAndServeTLS(serverCertPath, serverKeyPath); err != http.ErrServerClosed {
-		log.Fatalf("failed to start server: %s", err)
+	if err := http2.ConfigureServer(httpServer, &http2.Server{MaxConcurrentStreams: MaxConcurrentStreams}); err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+	return &Server{logger: logger, httpServer: httpServer}, nil
+}
+
+// Addr returns the address the server is configured to listen on.
+func (s *Server) Addr() string {
+	return s.httpServer.Addr
+}
+
+// Serve accepts connections on listener until Shutdown is called, after
+// which it returns nil.
+func (s *Server) Serve(listener net.Listener) error {
+	s.logger.Printf("N32 server - started listening on %s", listener.Addr())
+	// The certificate is already part of the TLS configuration.
+	if err := s.httpServer.ServeTLS(listener, "", ""); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("N32 server failed: %w", err)
 	}
-	log.Println("N32 server - stopped")
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for the requests in
+// flight to complete, or for ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	s.logger.Println("N32 server - stopped")
+	return err
 }
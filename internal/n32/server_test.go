@@ -0,0 +1,85 @@
+package n32_test
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+)
+
+func TestGivenOnlyPRINSContextWhenHandleN32fThenRequestIsRejected(t *testing.T) {
+	seppContext := &model.SEPPContext{}
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: model.PRINS})
+	forwarded := false
+	localHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = true
+	})
+
+	req := httptest.NewRequest("GET", "/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	req.TLS = peerTLS(t, "remote-sepp.example.com")
+	rr := httptest.NewRecorder()
+	n32.HandleN32f(rr, req, seppContext, localHandler)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if forwarded {
+		t.Errorf("Expected request not to be forwarded")
+	}
+}
+
+func TestGivenTLSOrNoneContextWhenHandleN32fThenRequestIsForwarded(t *testing.T) {
+	for _, securityCapability := range []model.SecurityCapability{model.TLS, model.NONE} {
+		seppContext := &model.SEPPContext{}
+		seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: "https://remote-sepp.example.com", SecurityCapability: securityCapability})
+		localHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		req := httptest.NewRequest("GET", "/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+		req.TLS = peerTLS(t, "remote-sepp.example.com")
+		rr := httptest.NewRecorder()
+		n32.HandleN32f(rr, req, seppContext, localHandler)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("Handler returned wrong status code with %s: got %v want %v", securityCapability, rr.Code, http.StatusAccepted)
+		}
+	}
+}
+
+func TestGivenRunningServerWhenShutdownThenServeReturnsNil(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeClientCertificate(t, dir)
+	store, err := certs.NewStore(certPath, keyPath, certPath, log.Default())
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	server, err := n32.NewServer("127.0.0.1:0", store, &model.SEPPContext{}, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	listener, err := net.Listen("tcp", server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Failed to shut down server: %v", err)
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("Expected Serve to return nil, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package prins
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitPointer splits an RFC 6901 JSON pointer into unescaped tokens.
+func splitPointer(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens
+}
+
+// replacePointer replaces the value referenced by pointer in document
+// with value and returns the previous one. It reports false when the
+// pointer does not reference an existing value.
+func replacePointer(document interface{}, pointer string, value interface{}) (interface{}, bool) {
+	tokens := splitPointer(pointer)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	parent := document
+	for _, token := range tokens[:len(tokens)-1] {
+		child, ok := lookupToken(parent, token)
+		if !ok {
+			return nil, false
+		}
+		parent = child
+	}
+	last := tokens[len(tokens)-1]
+	previous, ok := lookupToken(parent, last)
+	if !ok {
+		return nil, false
+	}
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+	case []interface{}:
+		index, _ := strconv.Atoi(last)
+		container[index] = value
+	}
+	return previous, true
+}
+
+// lookupPointer returns the value referenced by pointer in document.
+func lookupPointer(document interface{}, pointer string) (interface{}, bool) {
+	value := document
+	for _, token := range splitPointer(pointer) {
+		child, ok := lookupToken(value, token)
+		if !ok {
+			return nil, false
+		}
+		value = child
+	}
+	return value, true
+}
+
+// applyPatch applies a single RFC 6902 add, replace or remove operation
+// at the pointer tokens and returns the updated node.
+func applyPatch(node interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		if op == "remove" {
+			return nil, fmt.Errorf("cannot remove the whole document")
+		}
+		return value, nil
+	}
+	token := tokens[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, exists := container[token]
+		if len(tokens) > 1 {
+			if !exists {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			updated, err := applyPatch(child, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			container[token] = updated
+			return container, nil
+		}
+		switch op {
+		case "add":
+			container[token] = value
+		case "replace":
+			if !exists {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			container[token] = value
+		case "remove":
+			if !exists {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			delete(container, token)
+		default:
+			return nil, fmt.Errorf("unsupported operation %s", op)
+		}
+		return container, nil
+	case []interface{}:
+		if len(tokens) == 1 && op == "add" {
+			index := len(container)
+			if token != "-" {
+				var err error
+				index, err = strconv.Atoi(token)
+				if err != nil || index < 0 || index > len(container) {
+					return nil, fmt.Errorf("invalid array index: %s", token)
+				}
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index >= len(container) {
+			return nil, fmt.Errorf("invalid array index: %s", token)
+		}
+		if len(tokens) > 1 {
+			updated, err := applyPatch(container[index], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			container[index] = updated
+			return container, nil
+		}
+		switch op {
+		case "replace":
+			container[index] = value
+		case "remove":
+			container = append(container[:index], container[index+1:]...)
+		default:
+			return nil, fmt.Errorf("unsupported operation %s", op)
+		}
+		return container, nil
+	default:
+		return nil, fmt.Errorf("path not found: %s", token)
+	}
+}
+
+func lookupToken(document interface{}, token string) (interface{}, bool) {
+	switch container := document.(type) {
+	case map[string]interface{}:
+		value, ok := container[token]
+		return value, ok
+	case []interface{}:
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index >= len(container) {
+			return nil, false
+		}
+		return container[index], true
+	default:
+		return nil, false
+	}
+}
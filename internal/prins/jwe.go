@@ -0,0 +1,129 @@
+package prins
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	A128GCM = "A128GCM"
+	A256GCM = "A256GCM"
+	ES256   = "ES256"
+)
+
+// Cipher suites supported for N32-f, in order of preference.
+var (
+	SupportedJweCipherSuites = []string{A256GCM, A128GCM}
+	SupportedJwsCipherSuites = []string{ES256}
+)
+
+// SelectCipherSuite returns the first suite of the ordered preferred
+// list that is also present in offered.
+func SelectCipherSuite(preferred []string, offered []string) (string, bool) {
+	for _, cipherSuite := range preferred {
+		if slices.Contains(offered, cipherSuite) {
+			return cipherSuite, true
+		}
+	}
+	return "", false
+}
+
+// contentEncryption returns the JWE content encryption algorithm of
+// the cipher suite along with the session key truncated to its size.
+func contentEncryption(cipherSuite string, key []byte) (jose.ContentEncryption, []byte, error) {
+	switch cipherSuite {
+	case A128GCM:
+		return jose.A128GCM, key[:16], nil
+	case A256GCM, "":
+		return jose.A256GCM, key[:32], nil
+	default:
+		return "", nil, fmt.Errorf("unsupported JWE cipher suite %s", cipherSuite)
+	}
+}
+
+// encrypt builds the flattened JWE carrying the cipher block as
+// plaintext and the integrity block as additional authenticated data.
+func encrypt(cipherSuite string, key []byte, integrityBlock *DataToIntegrityProtectBlock, cipherBlock *DataToIntegrityProtectAndCipherBlock) (FlatJweJson, error) {
+	var reformattedData FlatJweJson
+	enc, key, err := contentEncryption(cipherSuite, key)
+	if err != nil {
+		return reformattedData, err
+	}
+	aad, err := json.Marshal(integrityBlock)
+	if err != nil {
+		return reformattedData, err
+	}
+	plaintext, err := json.Marshal(cipherBlock)
+	if err != nil {
+		return reformattedData, err
+	}
+	encrypter, err := jose.NewEncrypter(enc, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, nil)
+	if err != nil {
+		return reformattedData, fmt.Errorf("failed to create JWE encrypter: %w", err)
+	}
+	jwe, err := encrypter.EncryptWithAuthData(plaintext, aad)
+	if err != nil {
+		return reformattedData, fmt.Errorf("failed to encrypt N32-f message: %w", err)
+	}
+	err = json.Unmarshal([]byte(jwe.FullSerialize()), &reformattedData)
+	return reformattedData, err
+}
+
+// decrypt verifies the flattened JWE and returns its integrity
+// protected and decrypted blocks.
+func decrypt(cipherSuite string, key []byte, reformattedData FlatJweJson) (*DataToIntegrityProtectBlock, *DataToIntegrityProtectAndCipherBlock, error) {
+	enc, key, err := contentEncryption(cipherSuite, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialized, err := json.Marshal(reformattedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	jwe, err := jose.ParseEncryptedJSON(string(serialized), []jose.KeyAlgorithm{jose.DIRECT}, []jose.ContentEncryption{enc})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	plaintext, err := jwe.Decrypt(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrIntegrityCheckFailed, err)
+	}
+
+	integrityBlock := &DataToIntegrityProtectBlock{}
+	if err := unmarshalJSON(jwe.GetAuthData(), integrityBlock); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid integrity protected block: %v", ErrInvalidMessage, err)
+	}
+	cipherBlock := &DataToIntegrityProtectAndCipherBlock{}
+	if err := unmarshalJSON(plaintext, cipherBlock); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid encrypted block: %v", ErrInvalidMessage, err)
+	}
+	return integrityBlock, cipherBlock, nil
+}
+
+// PeekMetaData returns the metadata of a reformatted message before its
+// integrity is verified, so that the matching N32-f context can be found.
+func PeekMetaData(reformattedData FlatJweJson) (*MetaData, error) {
+	aad, err := base64.RawURLEncoding.DecodeString(reformattedData.Aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid aad: %v", ErrInvalidMessage, err)
+	}
+	integrityBlock := &DataToIntegrityProtectBlock{}
+	if err := unmarshalJSON(aad, integrityBlock); err != nil {
+		return nil, fmt.Errorf("%w: invalid integrity protected block: %v", ErrInvalidMessage, err)
+	}
+	if integrityBlock.MetaData == nil || integrityBlock.MetaData.N32fContextId == "" {
+		return nil, fmt.Errorf("%w: missing n32fContextId", ErrInvalidMessage)
+	}
+	return integrityBlock.MetaData, nil
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,119 @@
+package prins
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	exporterLabel    = "EXPORTER_3GPP_N32_MASTER"
+	masterKeyLength  = 64
+	sessionKeyLength = 32
+	contextIDLength  = 8
+)
+
+// NewContext derives the N32-f context and its session keys from the
+// TLS session used for the N32-c handshake. Both SEPPs derive the same
+// material from the shared exporter secret, initiator being the SEPP
+// that sent the exchange-capability request. The context uses the
+// preferred cipher suites until the parameter exchange updates them.
+func NewContext(state *tls.ConnectionState, remoteN32FQDN model.FQDN, initiator bool) (*model.PRINSContext, error) {
+	if state == nil {
+		return nil, fmt.Errorf("N32-c handshake was not performed over TLS")
+	}
+	masterKey, err := exportMasterKey(state)
+	if err != nil {
+		return nil, err
+	}
+	n32fContextID, err := contextID(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := []string{"request_key", "response_key", "parallel_request_key", "parallel_response_key"}
+	keys := make([][]byte, len(labels))
+	for i, label := range labels {
+		keys[i], err = expand(masterKey, "N32"+n32fContextID+label, sessionKeyLength)
+		if err != nil {
+			return nil, err
+		}
+	}
+	requestKey, responseKey, parallelRequestKey, parallelResponseKey := keys[0], keys[1], keys[2], keys[3]
+
+	prinsContext := &model.PRINSContext{
+		N32fContextID:  n32fContextID,
+		RemoteN32FQDN:  remoteN32FQDN,
+		JweCipherSuite: SupportedJweCipherSuites[0],
+		JwsCipherSuite: SupportedJwsCipherSuites[0],
+	}
+	if initiator {
+		prinsContext.Keys = model.PRINSKeys{
+			SendRequestKey:     requestKey,
+			ReceiveResponseKey: responseKey,
+			ReceiveRequestKey:  parallelRequestKey,
+			SendResponseKey:    parallelResponseKey,
+		}
+	} else {
+		prinsContext.Keys = model.PRINSKeys{
+			SendRequestKey:     parallelRequestKey,
+			ReceiveResponseKey: parallelResponseKey,
+			ReceiveRequestKey:  requestKey,
+			SendResponseKey:    responseKey,
+		}
+	}
+	return prinsContext, nil
+}
+
+// ContextID derives the N32-f context identifier from the TLS session
+// used for the N32-c handshake, so that both SEPPs agree on it without
+// exchanging it.
+func ContextID(state *tls.ConnectionState) (string, error) {
+	if state == nil {
+		return "", fmt.Errorf("N32-c handshake was not performed over TLS")
+	}
+	masterKey, err := exportMasterKey(state)
+	if err != nil {
+		return "", err
+	}
+	return contextID(masterKey)
+}
+
+func exportMasterKey(state *tls.ConnectionState) ([]byte, error) {
+	masterKey, err := state.ExportKeyingMaterial(exporterLabel, nil, masterKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export N32 master key: %w", err)
+	}
+	return masterKey, nil
+}
+
+func contextID(masterKey []byte) (string, error) {
+	id, err := expand(masterKey, "N32fContextId", contextIDLength)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func expand(masterKey []byte, info string, length int) ([]byte, error) {
+	key := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, masterKey, []byte(info)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive %s: %w", info, err)
+	}
+	return key, nil
+}
+
+// NewMessageID returns a random identifier for an N32-f message.
+func NewMessageID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,153 @@
+package prins
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/go-jose/go-jose/v4"
+)
+
+type PatchItem struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ModificationsBlock is the JWS payload through which an IPX provider
+// modifies the clear text part of an N32-f message.
+type ModificationsBlock struct {
+	Identity   string      `json:"identity"`
+	Operations []PatchItem `json:"operations"`
+}
+
+// modifiablePaths are the parts of the integrity protected block an IPX
+// provider may patch. The metadata and request line are never modified.
+var modifiablePaths = []string{"/headers/", "/payload/", "/statusLine"}
+
+// applyModifications verifies the signature of each modifications block
+// against the keys of the IPX providers announced by the remote SEPP
+// and applies its operations to the integrity protected block.
+func applyModifications(integrityBlock *DataToIntegrityProtectBlock, modificationsBlocks []FlatJwsJson, prinsContext *model.PRINSContext) (*DataToIntegrityProtectBlock, error) {
+	if len(modificationsBlocks) == 0 {
+		return integrityBlock, nil
+	}
+	authorizedIpxId := ""
+	if integrityBlock.MetaData != nil {
+		authorizedIpxId = integrityBlock.MetaData.AuthorizedIpxId
+	}
+	serialized, err := json.Marshal(integrityBlock)
+	if err != nil {
+		return nil, err
+	}
+	document, err := decodeJSON(serialized)
+	if err != nil {
+		return nil, err
+	}
+	for _, jws := range modificationsBlocks {
+		modifications, err := verifyModifications(jws, prinsContext)
+		if err != nil {
+			return nil, err
+		}
+		if modifications.Identity != authorizedIpxId {
+			return nil, fmt.Errorf("%w: IPX provider %s is not authorized", ErrModificationsFailed, modifications.Identity)
+		}
+		for _, operation := range modifications.Operations {
+			if !isModifiable(operation.Path) {
+				return nil, fmt.Errorf("%w: %s is not modifiable", ErrModificationsFailed, operation.Path)
+			}
+			document, err = applyPatch(document, splitPointer(operation.Path), operation.Op, operation.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrModificationsFailed, err)
+			}
+		}
+	}
+	serialized, err = json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	modified := &DataToIntegrityProtectBlock{}
+	if err := unmarshalJSON(serialized, modified); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModificationsFailed, err)
+	}
+	return modified, nil
+}
+
+func verifyModifications(jws FlatJwsJson, prinsContext *model.PRINSContext) (*ModificationsBlock, error) {
+	serialized, err := json.Marshal(jws)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := jose.ParseSignedJSON(string(serialized), []jose.SignatureAlgorithm{jose.SignatureAlgorithm(prinsContext.JwsCipherSuite)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModificationsFailed, err)
+	}
+	unverified := &ModificationsBlock{}
+	if err := json.Unmarshal(signature.UnsafePayloadWithoutVerification(), unverified); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModificationsFailed, err)
+	}
+	for _, ipxProvider := range prinsContext.RemoteIpxProviderSecInfoList {
+		if ipxProvider.IpxProviderId != unverified.Identity {
+			continue
+		}
+		for _, publicKey := range ipxPublicKeys(ipxProvider) {
+			payload, err := signature.Verify(publicKey)
+			if err != nil {
+				continue
+			}
+			modifications := &ModificationsBlock{}
+			if err := unmarshalJSON(payload, modifications); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrModificationsFailed, err)
+			}
+			return modifications, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no valid signature from IPX provider %s", ErrModificationsFailed, unverified.Identity)
+}
+
+// ipxPublicKeys parses the raw public keys and certificates of an IPX
+// provider, given either in PEM or as base64 encoded DER.
+func ipxPublicKeys(ipxProvider model.IpxProviderSecInfo) []crypto.PublicKey {
+	var publicKeys []crypto.PublicKey
+	for _, rawPublicKey := range ipxProvider.RawPublicKeyList {
+		if der := decodeKeyMaterial(rawPublicKey); der != nil {
+			if publicKey, err := x509.ParsePKIXPublicKey(der); err == nil {
+				publicKeys = append(publicKeys, publicKey)
+			}
+		}
+	}
+	for _, certificate := range ipxProvider.CertificateList {
+		if der := decodeKeyMaterial(certificate); der != nil {
+			if cert, err := x509.ParseCertificate(der); err == nil {
+				publicKeys = append(publicKeys, cert.PublicKey)
+			}
+		}
+	}
+	return publicKeys
+}
+
+func decodeKeyMaterial(encoded string) []byte {
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		return block.Bytes
+	}
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return der
+}
+
+func isModifiable(path string) bool {
+	for _, modifiablePath := range modifiablePaths {
+		if strings.HasPrefix(path, modifiablePath) || path == strings.TrimSuffix(modifiablePath, "/") {
+			return true
+		}
+	}
+	return false
+}
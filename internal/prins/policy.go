@@ -0,0 +1,175 @@
+package prins
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+const apiRootVariable = "{apiRoot}"
+
+// protectedIE is an IE to encrypt along with the resource URI template
+// of the API it belongs to.
+type protectedIE struct {
+	model.IeInfo
+	uri string
+}
+
+// encryptedIEs returns the IEs of the API invoked with method and path
+// whose type must be encrypted according to the protection policy.
+func encryptedIEs(policy model.ProtectionPolicy, method string, path string) []protectedIE {
+	var ies []protectedIE
+	for _, mapping := range policy.ApiIeMappingList {
+		if !strings.EqualFold(mapping.ApiMethod, method) || !matchURI(mapping.ApiSignature.Uri, path) {
+			continue
+		}
+		for _, ie := range mapping.IeList {
+			if slices.Contains(policy.DataTypeEncPolicy, ie.IeType) {
+				ies = append(ies, protectedIE{IeInfo: ie, uri: mapping.ApiSignature.Uri})
+			}
+		}
+	}
+	return ies
+}
+
+// matchURI reports whether path matches the resource URI template,
+// where each {variable} matches exactly one path segment.
+func matchURI(template string, path string) bool {
+	if template == "" {
+		return false
+	}
+	template = strings.TrimPrefix(template, apiRootVariable)
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(templateSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range templateSegments {
+		if isVariable(segment) {
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// uriVariableIndex returns the position of the {name} variable in the
+// segments of the resource URI template.
+func uriVariableIndex(template string, name string) int {
+	template = strings.TrimPrefix(template, apiRootVariable)
+	for i, segment := range strings.Split(strings.Trim(template, "/"), "/") {
+		if segment == "{"+name+"}" {
+			return i
+		}
+	}
+	return -1
+}
+
+func isVariable(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// checkPolicy verifies that none of the IEs the protection policy
+// requires to be encrypted was sent in clear text.
+func checkPolicy(integrityBlock *DataToIntegrityProtectBlock, ies []protectedIE, ieName func(protectedIE) string) error {
+	for _, ie := range ies {
+		name := ieName(ie)
+		if name == "" {
+			continue
+		}
+		switch ie.IeLoc {
+		case model.IeLocationUriParam:
+			if integrityBlock.RequestLine != nil && !uriParamEncrypted(integrityBlock.RequestLine, ie.uri, name) {
+				return fmt.Errorf("%w: URI parameter %s is not encrypted", ErrPolicyViolation, name)
+			}
+		case model.IeLocationHeader:
+			for _, header := range integrityBlock.Headers {
+				if strings.EqualFold(header.Header, name) && header.Value.EncBlockIdx == nil {
+					return fmt.Errorf("%w: header %s is not encrypted", ErrPolicyViolation, name)
+				}
+			}
+		case model.IeLocationBody:
+			for _, payload := range integrityBlock.Payload {
+				if payload.IeValueLocation != model.IeLocationBody || payload.IePath != "" {
+					continue
+				}
+				if value, ok := lookupPointer(payload.Value, name); ok && !isEncBlock(value) {
+					return fmt.Errorf("%w: body IE %s is not encrypted", ErrPolicyViolation, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func uriParamEncrypted(requestLine *RequestLine, uri string, name string) bool {
+	if index := uriVariableIndex(uri, name); index >= 0 {
+		segments := strings.Split(requestLine.Path, "/")
+		return index+1 >= len(segments) || isPlaceholder(segments[index+1])
+	}
+	if requestLine.QueryFragment == "" {
+		return true
+	}
+	for _, pair := range strings.Split(requestLine.QueryFragment, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		if unescapedKey, err := url.QueryUnescape(key); err == nil && unescapedKey == name && !isPlaceholder(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPlaceholder(s string) bool {
+	return placeholderPattern.FindString(s) == s
+}
+
+func isEncBlock(value interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok || len(object) != 1 {
+		return false
+	}
+	_, ok = object[encBlockIdxKey]
+	return ok
+}
+
+// MergeProtectionPolicies combines the local protection policy with the
+// one received from the remote SEPP, so that an IE is encrypted as soon
+// as either SEPP requires it.
+func MergeProtectionPolicies(local model.ProtectionPolicy, remote model.ProtectionPolicy) model.ProtectionPolicy {
+	merged := model.ProtectionPolicy{
+		ApiIeMappingList:  make([]model.ApiIeMapping, 0, len(local.ApiIeMappingList)+len(remote.ApiIeMappingList)),
+		DataTypeEncPolicy: slices.Clone(local.DataTypeEncPolicy),
+	}
+	for _, mapping := range local.ApiIeMappingList {
+		mapping.IeList = slices.Clone(mapping.IeList)
+		merged.ApiIeMappingList = append(merged.ApiIeMappingList, mapping)
+	}
+	for _, mapping := range remote.ApiIeMappingList {
+		index := slices.IndexFunc(merged.ApiIeMappingList, func(m model.ApiIeMapping) bool {
+			return m.ApiSignature == mapping.ApiSignature && m.ApiMethod == mapping.ApiMethod
+		})
+		if index < 0 {
+			mapping.IeList = slices.Clone(mapping.IeList)
+			merged.ApiIeMappingList = append(merged.ApiIeMappingList, mapping)
+			continue
+		}
+		for _, ie := range mapping.IeList {
+			if !slices.ContainsFunc(merged.ApiIeMappingList[index].IeList, func(i model.IeInfo) bool {
+				return i.IeLoc == ie.IeLoc && i.ReqIe == ie.ReqIe && i.RspIe == ie.RspIe
+			}) {
+				merged.ApiIeMappingList[index].IeList = append(merged.ApiIeMappingList[index].IeList, ie)
+			}
+		}
+	}
+	for _, ieType := range remote.DataTypeEncPolicy {
+		if !slices.Contains(merged.DataTypeEncPolicy, ieType) {
+			merged.DataTypeEncPolicy = append(merged.DataTypeEncPolicy, ieType)
+		}
+	}
+	return merged
+}
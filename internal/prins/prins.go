@@ -0,0 +1,117 @@
+// Package prins implements the PRotocol for N32 INterconnect Security
+// (TS 33.501 clause 13.2 and TS 29.573 clause 6.2) used to protect
+// N32-f messages at the application layer.
+package prins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+var (
+	ErrUnknownContext       = errors.New("unknown N32-f context")
+	ErrIntegrityCheckFailed = errors.New("integrity check failed")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrInvalidMessage       = errors.New("invalid reformatted message")
+	ErrPolicyViolation      = errors.New("protection policy violation")
+	ErrModificationsFailed  = errors.New("integrity check on modifications failed")
+)
+
+type FlatJweJson struct {
+	Protected    string                 `json:"protected,omitempty"`
+	Unprotected  map[string]interface{} `json:"unprotected,omitempty"`
+	Header       map[string]interface{} `json:"header,omitempty"`
+	EncryptedKey string                 `json:"encrypted_key,omitempty"`
+	Aad          string                 `json:"aad,omitempty"`
+	Iv           string                 `json:"iv,omitempty"`
+	Ciphertext   string                 `json:"ciphertext"`
+	Tag          string                 `json:"tag,omitempty"`
+}
+
+type FlatJwsJson struct {
+	Payload   string                 `json:"payload"`
+	Protected string                 `json:"protected,omitempty"`
+	Header    map[string]interface{} `json:"header,omitempty"`
+	Signature string                 `json:"signature"`
+}
+
+type N32fReformattedReqMsg struct {
+	ReformattedData    FlatJweJson   `json:"reformattedData"`
+	ModificationsBlock []FlatJwsJson `json:"modificationsBlock,omitempty"`
+}
+
+type N32fReformattedRspMsg struct {
+	ReformattedData    FlatJweJson   `json:"reformattedData"`
+	ModificationsBlock []FlatJwsJson `json:"modificationsBlock,omitempty"`
+}
+
+type MetaData struct {
+	N32fContextId   string `json:"n32fContextId"`
+	MessageId       string `json:"messageId"`
+	AuthorizedIpxId string `json:"authorizedIpxId"`
+}
+
+type RequestLine struct {
+	Method          string `json:"method"`
+	Scheme          string `json:"scheme"`
+	Authority       string `json:"authority"`
+	Path            string `json:"path"`
+	ProtocolVersion string `json:"protocolVersion"`
+	QueryFragment   string `json:"queryFragment,omitempty"`
+}
+
+// EncodedHttpHeaderValue is either the clear text value of a header
+// or the index of its value in the encrypted block.
+type EncodedHttpHeaderValue struct {
+	Value       string
+	EncBlockIdx *int
+}
+
+func (v EncodedHttpHeaderValue) MarshalJSON() ([]byte, error) {
+	if v.EncBlockIdx != nil {
+		return json.Marshal(map[string]int{encBlockIdxKey: *v.EncBlockIdx})
+	}
+	return json.Marshal(v.Value)
+}
+
+func (v *EncodedHttpHeaderValue) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &v.Value); err == nil {
+		return nil
+	}
+	var encoded map[string]int
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("invalid header value: %w", err)
+	}
+	encBlockIdx, ok := encoded[encBlockIdxKey]
+	if !ok {
+		return fmt.Errorf("invalid header value: missing %s", encBlockIdxKey)
+	}
+	v.EncBlockIdx = &encBlockIdx
+	return nil
+}
+
+type HttpHeader struct {
+	Header string                 `json:"header"`
+	Value  EncodedHttpHeaderValue `json:"value"`
+}
+
+type HttpPayload struct {
+	IePath          string           `json:"iePath"`
+	IeValueLocation model.IeLocation `json:"ieValueLocation"`
+	Value           interface{}      `json:"value"`
+}
+
+type DataToIntegrityProtectBlock struct {
+	MetaData    *MetaData     `json:"metaData,omitempty"`
+	RequestLine *RequestLine  `json:"requestLine,omitempty"`
+	StatusLine  string        `json:"statusLine,omitempty"`
+	Headers     []HttpHeader  `json:"headers,omitempty"`
+	Payload     []HttpPayload `json:"payload,omitempty"`
+}
+
+type DataToIntegrityProtectAndCipherBlock struct {
+	DataToEncrypt []interface{} `json:"dataToEncrypt"`
+}
@@ -0,0 +1,316 @@
+package prins_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/prins"
+)
+
+func newContextPair() (*model.PRINSContext, *model.PRINSContext) {
+	requestKey := bytes.Repeat([]byte{1}, 32)
+	responseKey := bytes.Repeat([]byte{2}, 32)
+	sender := &model.PRINSContext{
+		N32fContextID:    "0123456789abcdef",
+		RemoteN32FQDN:    "remote-sepp.example.com",
+		Keys:             model.PRINSKeys{SendRequestKey: requestKey, ReceiveResponseKey: responseKey},
+		ProtectionPolicy: testPolicy(),
+	}
+	receiver := &model.PRINSContext{
+		N32fContextID:    "0123456789abcdef",
+		RemoteN32FQDN:    "local-sepp.example.com",
+		Keys:             model.PRINSKeys{ReceiveRequestKey: requestKey, SendResponseKey: responseKey},
+		ProtectionPolicy: testPolicy(),
+	}
+	return sender, receiver
+}
+
+func testPolicy() model.ProtectionPolicy {
+	return model.ProtectionPolicy{
+		ApiIeMappingList: []model.ApiIeMapping{
+			{
+				ApiSignature: model.ApiSignature{Uri: "{apiRoot}/nudm-uecm/v1/{ueId}/registrations/amf-3gpp-access"},
+				ApiMethod:    "PUT",
+				IeList: []model.IeInfo{
+					{IeLoc: model.IeLocationUriParam, IeType: model.IeTypeUeId, ReqIe: "ueId"},
+					{IeLoc: model.IeLocationHeader, IeType: model.IeTypeAuthorizationToken, ReqIe: "Authorization"},
+					{IeLoc: model.IeLocationBody, IeType: model.IeTypeUeId, ReqIe: "/pei", RspIe: "/pei"},
+					{IeLoc: model.IeLocationBody, IeType: model.IeTypeNonSensitive, ReqIe: "/amfInstanceId"},
+				},
+			},
+		},
+		DataTypeEncPolicy: []model.IeType{model.IeTypeUeId, model.IeTypeAuthorizationToken},
+	}
+}
+
+func TestGivenProtectedRequestWhenUnprotectRequestThenOriginalRequestIsRestored(t *testing.T) {
+	sender, receiver := newContextPair()
+	body := `{"amfInstanceId":"amf-1","pei":"imeisv-1234567890123456","guami":{"amfId":"010203"}}`
+	req := httptest.NewRequest("PUT", "https://nudm.example.com/nudm-uecm/v1/imsi-001010000000001/registrations/amf-3gpp-access?supported-features=1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret-token")
+
+	reqMsg, err := prins.ProtectRequest(req, []byte(body), sender, "message-1")
+	if err != nil {
+		t.Fatalf("Failed to protect request: %v", err)
+	}
+
+	serialized, err := json.Marshal(reqMsg)
+	if err != nil {
+		t.Fatalf("Failed to marshal reformatted message: %v", err)
+	}
+	for _, secret := range []string{"imsi-001010000000001", "secret-token", "imeisv-1234567890123456"} {
+		if bytes.Contains(serialized, []byte(secret)) {
+			t.Errorf("Reformatted message contains clear text value %s", secret)
+		}
+	}
+
+	metaData, err := prins.PeekMetaData(reqMsg.ReformattedData)
+	if err != nil {
+		t.Fatalf("Failed to peek metadata: %v", err)
+	}
+	if metaData.N32fContextId != sender.N32fContextID || metaData.MessageId != "message-1" {
+		t.Errorf("Unexpected metadata: %+v", metaData)
+	}
+
+	restored, _, err := prins.UnprotectRequest(context.Background(), reqMsg, receiver)
+	if err != nil {
+		t.Fatalf("Failed to unprotect request: %v", err)
+	}
+
+	if restored.Method != "PUT" {
+		t.Errorf("Expected method 'PUT', got '%s'", restored.Method)
+	}
+	if restored.URL.Path != "/nudm-uecm/v1/imsi-001010000000001/registrations/amf-3gpp-access" {
+		t.Errorf("Unexpected path '%s'", restored.URL.Path)
+	}
+	if restored.URL.RawQuery != "supported-features=1" {
+		t.Errorf("Unexpected query '%s'", restored.URL.RawQuery)
+	}
+	if restored.Host != "nudm.example.com" {
+		t.Errorf("Expected host 'nudm.example.com', got '%s'", restored.Host)
+	}
+	if restored.Header.Get("Authorization") != "Bearer secret-token" {
+		t.Errorf("Expected Authorization 'Bearer secret-token', got '%s'", restored.Header.Get("Authorization"))
+	}
+	restoredBody, err := io.ReadAll(restored.Body)
+	if err != nil {
+		t.Fatalf("Failed to read restored body: %v", err)
+	}
+	var expected, actual interface{}
+	_ = json.Unmarshal([]byte(body), &expected)
+	if err := json.Unmarshal(restoredBody, &actual); err != nil {
+		t.Fatalf("Failed to unmarshal restored body: %v", err)
+	}
+	if !jsonEqual(expected, actual) {
+		t.Errorf("Unexpected restored body:\nGot:  %s\nWant: %s", restoredBody, body)
+	}
+}
+
+func TestGivenContextWhenUnprotectRequestThenRestoredRequestUsesIt(t *testing.T) {
+	sender, receiver := newContextPair()
+	req := httptest.NewRequest("GET", "https://nudm.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	reqMsg, err := prins.ProtectRequest(req, nil, sender, "message-1")
+	if err != nil {
+		t.Fatalf("Failed to protect request: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	restored, _, err := prins.UnprotectRequest(ctx, reqMsg, receiver)
+
+	if err != nil {
+		t.Fatalf("Failed to unprotect request: %v", err)
+	}
+	if restored.Context().Err() == nil {
+		t.Errorf("Expected the restored request to be cancelled with ctx")
+	}
+}
+
+func TestGivenTamperedRequestWhenUnprotectRequestThenIntegrityCheckFails(t *testing.T) {
+	sender, receiver := newContextPair()
+	req := httptest.NewRequest("GET", "https://nudm.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+
+	reqMsg, err := prins.ProtectRequest(req, nil, sender, "message-1")
+	if err != nil {
+		t.Fatalf("Failed to protect request: %v", err)
+	}
+	aad, err := base64.RawURLEncoding.DecodeString(reqMsg.ReformattedData.Aad)
+	if err != nil {
+		t.Fatalf("Failed to decode aad: %v", err)
+	}
+	aad = bytes.Replace(aad, []byte("/nudm-sdm/v2/"), []byte("/nudm-sdm/v3/"), 1)
+	reqMsg.ReformattedData.Aad = base64.RawURLEncoding.EncodeToString(aad)
+
+	_, _, err = prins.UnprotectRequest(context.Background(), reqMsg, receiver)
+	if !errors.Is(err, prins.ErrIntegrityCheckFailed) {
+		t.Errorf("Expected integrity check failure, got %v", err)
+	}
+}
+
+func TestGivenSenderPolicyWeakerThanReceiverPolicyWhenUnprotectRequestThenPolicyViolation(t *testing.T) {
+	sender, receiver := newContextPair()
+	sender.ProtectionPolicy = model.ProtectionPolicy{}
+	req := httptest.NewRequest("PUT", "https://nudm.example.com/nudm-uecm/v1/imsi-001010000000001/registrations/amf-3gpp-access", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+
+	reqMsg, err := prins.ProtectRequest(req, nil, sender, "message-1")
+	if err != nil {
+		t.Fatalf("Failed to protect request: %v", err)
+	}
+
+	_, _, err = prins.UnprotectRequest(context.Background(), reqMsg, receiver)
+	if !errors.Is(err, prins.ErrPolicyViolation) {
+		t.Errorf("Expected policy violation, got %v", err)
+	}
+}
+
+func TestGivenLocalAndRemotePoliciesWhenMergeProtectionPoliciesThenUnionIsReturned(t *testing.T) {
+	remote := model.ProtectionPolicy{
+		ApiIeMappingList: []model.ApiIeMapping{
+			{
+				ApiSignature: model.ApiSignature{Uri: "{apiRoot}/nudm-sdm/v2/{supi}/am-data"},
+				ApiMethod:    "GET",
+				IeList:       []model.IeInfo{{IeLoc: model.IeLocationUriParam, IeType: model.IeTypeUeId, ReqIe: "supi"}},
+			},
+		},
+		DataTypeEncPolicy: []model.IeType{model.IeTypeLocation},
+	}
+
+	merged := prins.MergeProtectionPolicies(testPolicy(), remote)
+
+	if len(merged.ApiIeMappingList) != 2 {
+		t.Errorf("Expected 2 API IE mappings, got %d", len(merged.ApiIeMappingList))
+	}
+	if len(merged.DataTypeEncPolicy) != 3 {
+		t.Errorf("Expected 3 data types, got %v", merged.DataTypeEncPolicy)
+	}
+}
+
+func TestGivenIdenticalPoliciesWhenMergeProtectionPoliciesThenIEsAreNotDuplicated(t *testing.T) {
+	merged := prins.MergeProtectionPolicies(testPolicy(), testPolicy())
+
+	if !reflect.DeepEqual(merged, testPolicy()) {
+		t.Errorf("Unexpected merged policy:\nGot:  %+v\nWant: %+v", merged, testPolicy())
+	}
+}
+
+func TestGivenProtectedResponseWhenUnprotectResponseThenOriginalResponseIsRestored(t *testing.T) {
+	sender, receiver := newContextPair()
+	req := httptest.NewRequest("PUT", "https://nudm.example.com/nudm-uecm/v1/imsi-001010000000001/registrations/amf-3gpp-access", nil)
+	header := http.Header{"Content-Type": []string{"application/json"}, "Location": []string{"https://nudm.example.com/registrations/1"}}
+	body := `{"pei":"imeisv-1234567890123456"}`
+
+	rspMsg, err := prins.ProtectResponse(http.StatusCreated, header, []byte(body), req, receiver, &prins.MetaData{N32fContextId: receiver.N32fContextID, MessageId: "message-1"})
+	if err != nil {
+		t.Fatalf("Failed to protect response: %v", err)
+	}
+
+	serialized, err := json.Marshal(rspMsg)
+	if err != nil {
+		t.Fatalf("Failed to marshal reformatted message: %v", err)
+	}
+	if bytes.Contains(serialized, []byte("imeisv-1234567890123456")) {
+		t.Errorf("Reformatted message contains clear text pei")
+	}
+
+	statusCode, restoredHeader, restoredBody, err := prins.UnprotectResponse(rspMsg, req, sender)
+	if err != nil {
+		t.Fatalf("Failed to unprotect response: %v", err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, statusCode)
+	}
+	if restoredHeader.Get("Location") != "https://nudm.example.com/registrations/1" {
+		t.Errorf("Unexpected Location '%s'", restoredHeader.Get("Location"))
+	}
+	if string(restoredBody) != body {
+		t.Errorf("Unexpected restored body:\nGot:  %s\nWant: %s", restoredBody, body)
+	}
+}
+
+func TestGivenNonJSONResponseWhenProtectResponseThenStatusIsSentWithoutBody(t *testing.T) {
+	sender, receiver := newContextPair()
+	req := httptest.NewRequest("GET", "https://nudm.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	header := http.Header{"Content-Type": []string{"text/plain"}, "Location": []string{"https://nudm.example.com/am-data/1"}}
+
+	rspMsg, err := prins.ProtectResponse(http.StatusNotFound, header, []byte("not found"), req, receiver, &prins.MetaData{N32fContextId: receiver.N32fContextID, MessageId: "message-1"})
+	if err != nil {
+		t.Fatalf("Failed to protect response: %v", err)
+	}
+
+	statusCode, restoredHeader, restoredBody, err := prins.UnprotectResponse(rspMsg, req, sender)
+	if err != nil {
+		t.Fatalf("Failed to unprotect response: %v", err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, statusCode)
+	}
+	if restoredHeader.Get("Location") != "https://nudm.example.com/am-data/1" {
+		t.Errorf("Unexpected Location '%s'", restoredHeader.Get("Location"))
+	}
+	if contentType := restoredHeader.Get("Content-Type"); contentType != "" {
+		t.Errorf("Unexpected Content-Type '%s' without body", contentType)
+	}
+	if len(restoredBody) != 0 {
+		t.Errorf("Unexpected restored body %q", restoredBody)
+	}
+	if header.Get("Content-Type") != "text/plain" {
+		t.Errorf("Header of the local NF response was modified")
+	}
+}
+
+func TestGivenN32cTLSSessionWhenNewContextThenBothSEPPsDeriveMatchingKeys(t *testing.T) {
+	var responder *model.PRINSContext
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		responder, err = prins.NewContext(r.TLS, "initiating-sepp.example.com", false)
+		if err != nil {
+			t.Errorf("Failed to create responder context: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to perform request: %v", err)
+	}
+	resp.Body.Close()
+
+	initiator, err := prins.NewContext(resp.TLS, "responding-sepp.example.com", true)
+	if err != nil {
+		t.Fatalf("Failed to create initiator context: %v", err)
+	}
+
+	if initiator.N32fContextID != responder.N32fContextID {
+		t.Errorf("N32-f context IDs differ: %s != %s", initiator.N32fContextID, responder.N32fContextID)
+	}
+	if !bytes.Equal(initiator.Keys.SendRequestKey, responder.Keys.ReceiveRequestKey) {
+		t.Errorf("Initiator request key does not match responder")
+	}
+	if !bytes.Equal(initiator.Keys.ReceiveResponseKey, responder.Keys.SendResponseKey) {
+		t.Errorf("Initiator response key does not match responder")
+	}
+	if !bytes.Equal(responder.Keys.SendRequestKey, initiator.Keys.ReceiveRequestKey) {
+		t.Errorf("Responder request key does not match initiator")
+	}
+	if bytes.Equal(initiator.Keys.SendRequestKey, initiator.Keys.ReceiveRequestKey) {
+		t.Errorf("Request keys of both directions are equal")
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return bytes.Equal(aJSON, bJSON)
+}
@@ -0,0 +1,405 @@
+package prins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+const (
+	encBlockIdxKey  = "encBlockIdx"
+	authorizedIpxId = "NULL"
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{([0-9]+)\}`)
+	hopByHopHeaders    = []string{"Connection", "Content-Length", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+)
+
+// ProtectRequest reformats an HTTP request into an N32fReformattedReqMsg.
+// The IEs selected by the protection policy of the context are moved to
+// the encrypted block, the rest of the message is integrity protected
+// as JWE AAD.
+func ProtectRequest(r *http.Request, body []byte, prinsContext *model.PRINSContext, messageID string) (*N32fReformattedReqMsg, error) {
+	ies := encryptedIEs(prinsContext.ProtectionPolicy, r.Method, r.URL.Path)
+	cipherBlock := &DataToIntegrityProtectAndCipherBlock{DataToEncrypt: []interface{}{}}
+
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "https"
+		if r.TLS == nil {
+			scheme = "http"
+		}
+	}
+	path, query := reformatURI(r.URL, ies, cipherBlock)
+	payload, err := reformatPayload(r.Header, body, ies, requestIe, cipherBlock)
+	if err != nil {
+		return nil, err
+	}
+	integrityBlock := &DataToIntegrityProtectBlock{
+		MetaData: &MetaData{
+			N32fContextId:   prinsContext.N32fContextID,
+			MessageId:       messageID,
+			AuthorizedIpxId: authorizedIpxId,
+		},
+		RequestLine: &RequestLine{
+			Method:          r.Method,
+			Scheme:          scheme,
+			Authority:       r.Host,
+			Path:            path,
+			ProtocolVersion: r.Proto,
+			QueryFragment:   query,
+		},
+		Headers: reformatHeaders(r.Header, ies, requestIe, cipherBlock),
+		Payload: payload,
+	}
+
+	reformattedData, err := encrypt(prinsContext.JweCipherSuite, prinsContext.Keys.SendRequestKey, integrityBlock, cipherBlock)
+	if err != nil {
+		return nil, err
+	}
+	return &N32fReformattedReqMsg{ReformattedData: reformattedData}, nil
+}
+
+// UnprotectRequest verifies and decrypts an N32fReformattedReqMsg,
+// checks it against the protection policy, applies the modifications
+// of authorized IPX providers and rebuilds the original HTTP request
+// with ctx.
+func UnprotectRequest(ctx context.Context, msg *N32fReformattedReqMsg, prinsContext *model.PRINSContext) (*http.Request, *MetaData, error) {
+	integrityBlock, cipherBlock, err := decrypt(prinsContext.JweCipherSuite, prinsContext.Keys.ReceiveRequestKey, msg.ReformattedData)
+	if err != nil {
+		return nil, nil, err
+	}
+	if integrityBlock.MetaData == nil || integrityBlock.RequestLine == nil {
+		return nil, nil, fmt.Errorf("%w: missing metaData or requestLine", ErrInvalidMessage)
+	}
+	ies := encryptedIEs(prinsContext.ProtectionPolicy, integrityBlock.RequestLine.Method, integrityBlock.RequestLine.Path)
+	if err := checkPolicy(integrityBlock, ies, requestIe); err != nil {
+		return nil, nil, err
+	}
+	integrityBlock, err = applyModifications(integrityBlock, msg.ModificationsBlock, prinsContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	requestLine := integrityBlock.RequestLine
+	path, err := restorePlaceholders(requestLine.Path, cipherBlock.DataToEncrypt, url.PathEscape)
+	if err != nil {
+		return nil, nil, err
+	}
+	query, err := restorePlaceholders(requestLine.QueryFragment, cipherBlock.DataToEncrypt, url.QueryEscape)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := restoreHeaders(integrityBlock.Headers, cipherBlock.DataToEncrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := restorePayload(integrityBlock.Payload, cipherBlock.DataToEncrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target := requestLine.Scheme + "://" + requestLine.Authority + path
+	if query != "" {
+		target += "?" + query
+	}
+	r, err := http.NewRequestWithContext(ctx, requestLine.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	r.Header = header
+	r.Host = requestLine.Authority
+	return r, integrityBlock.MetaData, nil
+}
+
+// ProtectResponse reformats the response to request into an
+// N32fReformattedRspMsg using the same protection policy. Only JSON
+// bodies can be reformatted, other responses are sent with their status
+// code and headers but without their body.
+func ProtectResponse(statusCode int, header http.Header, body []byte, request *http.Request, prinsContext *model.PRINSContext, metaData *MetaData) (*N32fReformattedRspMsg, error) {
+	if len(body) > 0 && !isJSON(header.Get("Content-Type")) {
+		header = header.Clone()
+		header.Del("Content-Type")
+		header.Del("Content-Encoding")
+		body = nil
+	}
+	ies := encryptedIEs(prinsContext.ProtectionPolicy, request.Method, request.URL.Path)
+	cipherBlock := &DataToIntegrityProtectAndCipherBlock{DataToEncrypt: []interface{}{}}
+
+	payload, err := reformatPayload(header, body, ies, responseIe, cipherBlock)
+	if err != nil {
+		return nil, err
+	}
+	integrityBlock := &DataToIntegrityProtectBlock{
+		MetaData:   metaData,
+		StatusLine: strconv.Itoa(statusCode),
+		Headers:    reformatHeaders(header, ies, responseIe, cipherBlock),
+		Payload:    payload,
+	}
+
+	reformattedData, err := encrypt(prinsContext.JweCipherSuite, prinsContext.Keys.SendResponseKey, integrityBlock, cipherBlock)
+	if err != nil {
+		return nil, err
+	}
+	return &N32fReformattedRspMsg{ReformattedData: reformattedData}, nil
+}
+
+// UnprotectResponse verifies and decrypts the N32fReformattedRspMsg
+// answering request and returns the status code, headers and body of
+// the original response.
+func UnprotectResponse(msg *N32fReformattedRspMsg, request *http.Request, prinsContext *model.PRINSContext) (int, http.Header, []byte, error) {
+	integrityBlock, cipherBlock, err := decrypt(prinsContext.JweCipherSuite, prinsContext.Keys.ReceiveResponseKey, msg.ReformattedData)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	ies := encryptedIEs(prinsContext.ProtectionPolicy, request.Method, request.URL.Path)
+	if err := checkPolicy(integrityBlock, ies, responseIe); err != nil {
+		return 0, nil, nil, err
+	}
+	integrityBlock, err = applyModifications(integrityBlock, msg.ModificationsBlock, prinsContext)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	statusCode, err := strconv.Atoi(integrityBlock.StatusLine)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("%w: invalid statusLine %q", ErrInvalidMessage, integrityBlock.StatusLine)
+	}
+	header, err := restoreHeaders(integrityBlock.Headers, cipherBlock.DataToEncrypt)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	body, err := restorePayload(integrityBlock.Payload, cipherBlock.DataToEncrypt)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return statusCode, header, body, nil
+}
+
+func requestIe(ie protectedIE) string {
+	return ie.ReqIe
+}
+
+func responseIe(ie protectedIE) string {
+	return ie.RspIe
+}
+
+func (b *DataToIntegrityProtectAndCipherBlock) add(value interface{}) int {
+	b.DataToEncrypt = append(b.DataToEncrypt, value)
+	return len(b.DataToEncrypt) - 1
+}
+
+func placeholder(encBlockIdx int) string {
+	return "{" + strconv.Itoa(encBlockIdx) + "}"
+}
+
+// reformatURI replaces the URI parameters to encrypt, either path
+// variables or query parameters, with {encBlockIdx} placeholders.
+func reformatURI(u *url.URL, ies []protectedIE, cipherBlock *DataToIntegrityProtectAndCipherBlock) (string, string) {
+	segments := strings.Split(u.EscapedPath(), "/")
+	var queryPairs []string
+	if u.RawQuery != "" {
+		queryPairs = strings.Split(u.RawQuery, "&")
+	}
+	for _, ie := range ies {
+		if ie.IeLoc != model.IeLocationUriParam || ie.ReqIe == "" {
+			continue
+		}
+		if index := uriVariableIndex(ie.uri, ie.ReqIe); index >= 0 && index+1 < len(segments) {
+			value, err := url.PathUnescape(segments[index+1])
+			if err != nil {
+				value = segments[index+1]
+			}
+			segments[index+1] = placeholder(cipherBlock.add(value))
+			continue
+		}
+		for i, pair := range queryPairs {
+			key, value, _ := strings.Cut(pair, "=")
+			if unescapedKey, err := url.QueryUnescape(key); err != nil || unescapedKey != ie.ReqIe {
+				continue
+			}
+			unescapedValue, err := url.QueryUnescape(value)
+			if err != nil {
+				unescapedValue = value
+			}
+			queryPairs[i] = key + "=" + placeholder(cipherBlock.add(unescapedValue))
+		}
+	}
+	return strings.Join(segments, "/"), strings.Join(queryPairs, "&")
+}
+
+func reformatHeaders(header http.Header, ies []protectedIE, ieName func(protectedIE) string, cipherBlock *DataToIntegrityProtectAndCipherBlock) []HttpHeader {
+	encrypted := make(map[string]bool)
+	for _, ie := range ies {
+		if ie.IeLoc == model.IeLocationHeader && ieName(ie) != "" {
+			encrypted[http.CanonicalHeaderKey(ieName(ie))] = true
+		}
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var headers []HttpHeader
+	for _, name := range names {
+		if isHopByHop(name) {
+			continue
+		}
+		for _, value := range header[name] {
+			httpHeader := HttpHeader{Header: name, Value: EncodedHttpHeaderValue{Value: value}}
+			if encrypted[http.CanonicalHeaderKey(name)] {
+				encBlockIdx := cipherBlock.add(value)
+				httpHeader.Value = EncodedHttpHeaderValue{EncBlockIdx: &encBlockIdx}
+			}
+			headers = append(headers, httpHeader)
+		}
+	}
+	return headers
+}
+
+func reformatPayload(header http.Header, body []byte, ies []protectedIE, ieName func(protectedIE) string, cipherBlock *DataToIntegrityProtectAndCipherBlock) ([]HttpPayload, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if !isJSON(header.Get("Content-Type")) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, header.Get("Content-Type"))
+	}
+	document, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid JSON body: %v", ErrInvalidMessage, err)
+	}
+	for _, ie := range ies {
+		if ie.IeLoc != model.IeLocationBody || ieName(ie) == "" {
+			continue
+		}
+		encBlockIdx := len(cipherBlock.DataToEncrypt)
+		previous, ok := replacePointer(document, ieName(ie), map[string]interface{}{encBlockIdxKey: encBlockIdx})
+		if ok {
+			cipherBlock.add(previous)
+		}
+	}
+	return []HttpPayload{{IePath: "", IeValueLocation: model.IeLocationBody, Value: document}}, nil
+}
+
+func restorePlaceholders(s string, dataToEncrypt []interface{}, escape func(string) string) (string, error) {
+	var restoreErr error
+	restored := placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		encBlockIdx, _ := strconv.Atoi(match[1 : len(match)-1])
+		value, err := encryptedString(dataToEncrypt, encBlockIdx)
+		if err != nil {
+			restoreErr = err
+			return match
+		}
+		return escape(value)
+	})
+	return restored, restoreErr
+}
+
+func restoreHeaders(headers []HttpHeader, dataToEncrypt []interface{}) (http.Header, error) {
+	header := make(http.Header)
+	for _, httpHeader := range headers {
+		value := httpHeader.Value.Value
+		if httpHeader.Value.EncBlockIdx != nil {
+			decrypted, err := encryptedString(dataToEncrypt, *httpHeader.Value.EncBlockIdx)
+			if err != nil {
+				return nil, err
+			}
+			value = decrypted
+		}
+		header.Add(httpHeader.Header, value)
+	}
+	return header, nil
+}
+
+func restorePayload(payload []HttpPayload, dataToEncrypt []interface{}) ([]byte, error) {
+	for _, httpPayload := range payload {
+		if httpPayload.IeValueLocation != model.IeLocationBody || httpPayload.IePath != "" {
+			continue
+		}
+		document, err := restoreValue(httpPayload.Value, dataToEncrypt)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(document)
+	}
+	return nil, nil
+}
+
+// restoreValue walks a JSON document and replaces every encBlockIdx
+// object with the matching decrypted value.
+func restoreValue(value interface{}, dataToEncrypt []interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if encBlockIdx, ok := v[encBlockIdxKey]; ok && len(v) == 1 {
+			index, err := strconv.Atoi(fmt.Sprint(encBlockIdx))
+			if err != nil || index < 0 || index >= len(dataToEncrypt) {
+				return nil, fmt.Errorf("%w: invalid encBlockIdx %v", ErrInvalidMessage, encBlockIdx)
+			}
+			return dataToEncrypt[index], nil
+		}
+		for key, child := range v {
+			restored, err := restoreValue(child, dataToEncrypt)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = restored
+		}
+	case []interface{}:
+		for i, child := range v {
+			restored, err := restoreValue(child, dataToEncrypt)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = restored
+		}
+	}
+	return value, nil
+}
+
+func encryptedString(dataToEncrypt []interface{}, encBlockIdx int) (string, error) {
+	if encBlockIdx < 0 || encBlockIdx >= len(dataToEncrypt) {
+		return "", fmt.Errorf("%w: invalid encBlockIdx %d", ErrInvalidMessage, encBlockIdx)
+	}
+	value, ok := dataToEncrypt[encBlockIdx].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: encBlockIdx %d is not a string", ErrInvalidMessage, encBlockIdx)
+	}
+	return value, nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isHopByHop(name string) bool {
+	for _, hopByHopHeader := range hopByHopHeaders {
+		if strings.EqualFold(name, hopByHopHeader) {
+			return true
+		}
+	}
+	return false
+}
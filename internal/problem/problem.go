@@ -0,0 +1,40 @@
+package problem
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+const ContentType = "application/problem+json"
+
+// Write sends a ProblemDetails body with the given status code,
+// as required for error responses by TS 29.500 clause 5.2.4. Failures to
+// write the body are reported to logger.
+func Write(w http.ResponseWriter, logger *log.Logger, status int, cause string, detail string, invalidParams ...model.InvalidParam) {
+	problemDetails := model.ProblemDetails{
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        detail,
+		Cause:         cause,
+		InvalidParams: invalidParams,
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(problemDetails); err != nil {
+		logger.Printf("failed to write problem details: %v", err)
+	}
+}
+
+// Read decodes a ProblemDetails body from an error response. If the
+// body is not a ProblemDetails, one is built from the status code.
+func Read(resp *http.Response) *model.ProblemDetails {
+	problemDetails := &model.ProblemDetails{}
+	if err := json.NewDecoder(resp.Body).Decode(problemDetails); err != nil || problemDetails.Status == 0 {
+		problemDetails.Status = resp.StatusCode
+		problemDetails.Title = http.StatusText(resp.StatusCode)
+	}
+	return problemDetails
+}
@@ -0,0 +1,218 @@
+package sbi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/problem"
+	"golang.org/x/net/http2"
+)
+
+type localRoute struct {
+	apiPrefix string
+	apiRoot   *url.URL
+	h2c       bool
+}
+
+// h2cKey marks the requests to send with HTTP/2 in cleartext.
+type h2cKey struct{}
+
+// localNFs are the NFs requests from remote SEPPs may reach: those of
+// the routes and those named by an FQDN of the local PLMN.
+type localNFs struct {
+	plmnId model.PlmnId
+	routes []localRoute
+}
+
+// LocalForwarder forwards the requests received from remote SEPPs to
+// the NFs of the local PLMN and relays their responses.
+type LocalForwarder struct {
+	nfs          atomic.Pointer[localNFs]
+	reverseProxy *httputil.ReverseProxy
+	logger       *log.Logger
+}
+
+// NewLocalForwarder returns a forwarder reaching the local NFs with the
+// material of store. Requests naming neither a target apiRoot nor an NF
+// FQDN of plmnId are sent by routes.
+func NewLocalForwarder(plmnId model.PlmnId, routes []model.LocalRoute, store *certs.Store, logger *log.Logger) (*LocalForwarder, error) {
+	reverseProxy := &httputil.ReverseProxy{
+		// Requests are addressed to the target NF before being proxied.
+		Director:     func(*http.Request) {},
+		Transport:    newLocalTransport(store.DialTLSContext("h2", "http/1.1")),
+		ErrorHandler: localErrorHandler(logger),
+		ErrorLog:     logger,
+	}
+	forwarder := &LocalForwarder{reverseProxy: reverseProxy, logger: logger}
+	if err := forwarder.SetRoutes(plmnId, routes); err != nil {
+		return nil, err
+	}
+	return forwarder, nil
+}
+
+// SetRoutes replaces the local PLMN ID and the routes used by the
+// requests received from then on. A zero plmnId names no local NF.
+func (f *LocalForwarder) SetRoutes(plmnId model.PlmnId, routes []model.LocalRoute) error {
+	localRoutes := make([]localRoute, 0, len(routes))
+	for _, route := range routes {
+		apiRoot, err := url.Parse(route.ApiRoot)
+		if err != nil {
+			return fmt.Errorf("failed to parse apiRoot of route %s: %w", route.ApiPrefix, err)
+		}
+		localRoutes = append(localRoutes, localRoute{apiPrefix: route.ApiPrefix, apiRoot: apiRoot, h2c: route.H2C})
+	}
+	f.nfs.Store(&localNFs{plmnId: plmnId, routes: localRoutes})
+	return nil
+}
+
+// localTransport speaks HTTP/2 to the local NFs over TLS for https
+// apiRoots. NFs inside the core may run without TLS, http apiRoots are
+// reached with HTTP/1.1 unless their route asks for HTTP/2 with prior
+// knowledge (h2c).
+type localTransport struct {
+	transport *http.Transport
+	h2c       *http2.Transport
+}
+
+// newLocalTransport returns a transport establishing TLS connections with
+// dialTLS.
+func newLocalTransport(dialTLS func(ctx context.Context, network, addr string) (net.Conn, error)) *localTransport {
+	return &localTransport{
+		transport: &http.Transport{
+			DialTLSContext:    dialTLS,
+			ForceAttemptHTTP2: true,
+		},
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+func (t *localTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if h2c, _ := r.Context().Value(h2cKey{}).(bool); h2c && r.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(r)
+	}
+	return t.transport.RoundTrip(r)
+}
+
+// withH2C marks r to be sent with HTTP/2 in cleartext if the route it
+// follows asks for it.
+func withH2C(r *http.Request, route localRoute) *http.Request {
+	if !route.h2c {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), h2cKey{}, true))
+}
+
+func (f *LocalForwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, err := f.resolve(r)
+	if err != nil {
+		problem.Write(w, f.logger, http.StatusBadRequest, model.CauseOptionalIeIncorrect, err.Error(), model.InvalidParam{Param: TargetApiRootHeader, Reason: "invalid apiRoot"})
+		return
+	}
+	if target == nil {
+		problem.Write(w, f.logger, http.StatusNotFound, model.CauseTargetNfNotReachable, "No local NF for "+r.URL.Path)
+		f.logger.Printf("SBI server - no local NF for %s %s", r.Method, r.URL.Path)
+		return
+	}
+	f.logger.Printf("SBI server - forwarding %s %s to local NF %s", r.Method, r.URL.Path, target.URL.Host)
+	f.reverseProxy.ServeHTTP(w, target)
+}
+
+// resolve addresses r to the local NF named by its target apiRoot, by
+// the longest matching route or by its authority, in that order. Remote
+// SEPPs may only reach local NFs: it returns nil when r names any other
+// host or when no NF can be found.
+func (f *LocalForwarder) resolve(r *http.Request) (*http.Request, error) {
+	apiRoot, err := targetApiRoot(r)
+	if err != nil {
+		return nil, err
+	}
+	nfs := f.localNFs()
+	if apiRoot != nil {
+		if !nfs.isLocal(apiRoot.Host) {
+			f.logger.Printf("SBI server - rejected target apiRoot %s, not a local NF", apiRoot)
+			return nil, nil
+		}
+		route, _ := nfs.routeTo(apiRoot.Host)
+		return withH2C(withTargetApiRoot(r, apiRoot), route), nil
+	}
+	if route, ok := nfs.route(r.URL.Path); ok {
+		return withH2C(withTargetApiRoot(r, route.apiRoot), route), nil
+	}
+	if nfs.inPlmn(hostname(r.Host)) {
+		target := r.Clone(r.Context())
+		if target.URL.Scheme == "" {
+			target.URL.Scheme = "https"
+		}
+		target.URL.Host = r.Host
+		return target, nil
+	}
+	return nil, nil
+}
+
+func (f *LocalForwarder) localNFs() *localNFs {
+	if nfs := f.nfs.Load(); nfs != nil {
+		return nfs
+	}
+	return &localNFs{}
+}
+
+// isLocal reports whether host is the one of a route or an NF FQDN of
+// the local PLMN.
+func (nfs *localNFs) isLocal(host string) bool {
+	if _, ok := nfs.routeTo(host); ok {
+		return true
+	}
+	return nfs.inPlmn(hostname(host))
+}
+
+// routeTo returns the first route whose apiRoot is on host.
+func (nfs *localNFs) routeTo(host string) (localRoute, bool) {
+	for _, route := range nfs.routes {
+		if strings.EqualFold(route.apiRoot.Host, host) {
+			return route, true
+		}
+	}
+	return localRoute{}, false
+}
+
+// inPlmn reports whether fqdn is in the 3GPP network domain of the local
+// PLMN.
+func (nfs *localNFs) inPlmn(fqdn string) bool {
+	plmnId, ok := model.PlmnIdFromFQDN(fqdn)
+	return ok && nfs.plmnId != (model.PlmnId{}) && plmnId.Equal(nfs.plmnId)
+}
+
+func (nfs *localNFs) route(path string) (localRoute, bool) {
+	var match localRoute
+	found := false
+	for _, route := range nfs.routes {
+		if strings.HasPrefix(path, route.apiPrefix) && (!found || len(route.apiPrefix) > len(match.apiPrefix)) {
+			match = route
+			found = true
+		}
+	}
+	return match, found
+}
+
+func localErrorHandler(logger *log.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Printf("SBI server - failed to forward request to local NF: %v", err)
+		problem.Write(w, logger, http.StatusGatewayTimeout, model.CauseTargetNfNotReachable, "Failed to reach target NF")
+	}
+}
@@ -0,0 +1,222 @@
+package sbi
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// localPlmnId is the PLMN of the NFs of the test forwarders.
+var localPlmnId = model.PlmnId{Mcc: "001", Mnc: "01"}
+
+func newTestLocalForwarder(routes ...localRoute) *LocalForwarder {
+	forwarder := &LocalForwarder{
+		reverseProxy: &httputil.ReverseProxy{Director: func(*http.Request) {}, ErrorHandler: localErrorHandler(log.Default())},
+		logger:       log.Default(),
+	}
+	forwarder.nfs.Store(&localNFs{plmnId: localPlmnId, routes: routes})
+	return forwarder
+}
+
+func TestGivenMatchingRouteWhenForwardingThenRequestReachesLocalNF(t *testing.T) {
+	var receivedPath string
+	nf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"gpsis":["msisdn-0123456789"]}`))
+	}))
+	defer nf.Close()
+	nfURL, _ := url.Parse(nf.URL)
+	forwarder := newTestLocalForwarder(
+		localRoute{apiPrefix: "/", apiRoot: &url.URL{Scheme: "http", Host: "unused.example.com"}},
+		localRoute{apiPrefix: "/nudm-sdm/", apiRoot: nfURL},
+	)
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if receivedPath != "/nudm-sdm/v2/imsi-001010000000001/am-data" {
+		t.Errorf("Local NF received path %q", receivedPath)
+	}
+	body, _ := io.ReadAll(rr.Body)
+	if string(body) != `{"gpsis":["msisdn-0123456789"]}` {
+		t.Errorf("Unexpected response body %s", body)
+	}
+}
+
+func TestGivenTargetApiRootWhenForwardingThenHeaderIsConsumed(t *testing.T) {
+	var receivedHeader string
+	nf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeader = r.Header.Get(TargetApiRootHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer nf.Close()
+	nfURL, _ := url.Parse(nf.URL)
+	forwarder := newTestLocalForwarder(localRoute{apiPrefix: "/nausf-auth/", apiRoot: nfURL})
+
+	req := httptest.NewRequest("DELETE", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/sdm-subscriptions/1", nil)
+	req.Header.Set(TargetApiRootHeader, nf.URL)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if receivedHeader != "" {
+		t.Errorf("Expected %s header to be removed, got %q", TargetApiRootHeader, receivedHeader)
+	}
+}
+
+func TestGivenNoRouteWhenForwardingThenNotFoundIsReturned(t *testing.T) {
+	forwarder := newTestLocalForwarder(localRoute{apiPrefix: "/namf-comm/", apiRoot: &url.URL{Scheme: "https", Host: "amf.example.com"}})
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGivenUnreachableNFWhenForwardingThenGatewayTimeoutIsReturned(t *testing.T) {
+	nf := httptest.NewServer(http.NotFoundHandler())
+	nfURL, _ := url.Parse(nf.URL)
+	nf.Close()
+	forwarder := newTestLocalForwarder(localRoute{apiPrefix: "/", apiRoot: nfURL})
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+}
+
+func TestGivenHttpApiRootWhenForwardingThenHTTP11IsUsed(t *testing.T) {
+	var receivedProto string
+	nf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedProto = r.Proto
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer nf.Close()
+	nfURL, _ := url.Parse(nf.URL)
+	forwarder := newTestLocalForwarder(localRoute{apiPrefix: "/", apiRoot: nfURL})
+	forwarder.reverseProxy.Transport = newLocalTransport(nil)
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if receivedProto != "HTTP/1.1" {
+		t.Errorf("Local NF received %s request", receivedProto)
+	}
+}
+
+func TestGivenH2cRouteWhenForwardingThenH2cIsUsed(t *testing.T) {
+	var receivedProto string
+	nf := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedProto = r.Proto
+		w.WriteHeader(http.StatusOK)
+	}), &http2.Server{}))
+	defer nf.Close()
+	nfURL, _ := url.Parse(nf.URL)
+	forwarder := newTestLocalForwarder(localRoute{apiPrefix: "/", apiRoot: nfURL, h2c: true})
+	forwarder.reverseProxy.Transport = newLocalTransport(nil)
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if receivedProto != "HTTP/2.0" {
+		t.Errorf("Local NF received %s request", receivedProto)
+	}
+}
+
+func TestGivenReplacedRoutesWhenForwardingThenNewRoutesAreUsed(t *testing.T) {
+	nf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer nf.Close()
+	forwarder := newTestLocalForwarder()
+
+	if err := forwarder.SetRoutes(localPlmnId, []model.LocalRoute{{ApiPrefix: "/nudm-sdm/", ApiRoot: nf.URL}}); err != nil {
+		t.Fatalf("Failed to set routes: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Forwarder returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestGivenTargetApiRootOfUnknownHostWhenForwardingThenNotFoundIsReturned(t *testing.T) {
+	reached := false
+	nf := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer nf.Close()
+	forwarder := newTestLocalForwarder(localRoute{apiPrefix: "/nudm-sdm/", apiRoot: &url.URL{Scheme: "https", Host: "udm.example.com"}})
+
+	req := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	req.Header.Set(TargetApiRootHeader, nf.URL)
+	rr := httptest.NewRecorder()
+	forwarder.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound || reached {
+		t.Errorf("Expected 404 without reaching the host, got %v and reached %v", rr.Code, reached)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("Expected ProblemDetails, got %s", contentType)
+	}
+}
+
+func TestGivenAuthorityInLocalPlmnWhenResolvingThenNFIsTargeted(t *testing.T) {
+	forwarder := newTestLocalForwarder()
+	req := httptest.NewRequest("GET", "https://nudm.5gc.mnc001.mcc001.3gppnetwork.org/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+
+	target, err := forwarder.resolve(req)
+
+	if err != nil || target == nil {
+		t.Fatalf("Expected the local NF to be targeted, got %v %v", target, err)
+	}
+	if target.URL.Host != "nudm.5gc.mnc001.mcc001.3gppnetwork.org" {
+		t.Errorf("Unexpected target %s", target.URL)
+	}
+}
+
+func TestGivenAuthorityOrApiRootInAnotherPlmnWhenResolvingThenNothingIsTargeted(t *testing.T) {
+	forwarder := newTestLocalForwarder()
+	byAuthority := httptest.NewRequest("GET", "https://nudm.5gc.mnc002.mcc002.3gppnetwork.org/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	byApiRoot := httptest.NewRequest("GET", "https://sepp.example.com/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	byApiRoot.Header.Set(TargetApiRootHeader, "https://nudm.5gc.mnc002.mcc002.3gppnetwork.org")
+
+	for _, req := range []*http.Request{byAuthority, byApiRoot} {
+		target, err := forwarder.resolve(req)
+
+		if err != nil || target != nil {
+			t.Errorf("Expected no target, got %v %v", target, err)
+		}
+	}
+}
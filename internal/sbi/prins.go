@@ -0,0 +1,98 @@
+package sbi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/prins"
+	"github.com/dot-5g/sepp/internal/problem"
+)
+
+// forwardPRINS protects the request of a Network Function with PRINS,
+// sends it to the remote SEPP over N32-f and relays the unprotected
+// response back to the Network Function. Errors are reported to the
+// N32-c endpoint of the remote SEPP, which may differ from its N32-f one,
+// in the background.
+func forwardPRINS(w http.ResponseWriter, r *http.Request, n32fContext *model.N32fContext, n32Client *n32.Client, rewriter *uriRewriter, background Background, logger *log.Logger) {
+	prinsContext := n32fContext.PRINS
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, logger, http.StatusBadRequest, model.CauseInvalidMsgFormat, "Failed to read request body")
+		return
+	}
+
+	messageID := prins.NewMessageID()
+	reqMsg, err := prins.ProtectRequest(r, body, prinsContext, messageID)
+	if errors.Is(err, prins.ErrUnsupportedMediaType) {
+		problem.Write(w, logger, http.StatusUnsupportedMediaType, model.CauseInvalidMsgFormat, err.Error())
+		return
+	}
+	if err != nil {
+		problem.Write(w, logger, http.StatusBadRequest, model.CauseInvalidMsgFormat, err.Error())
+		return
+	}
+
+	rspMsg, err := n32Client.POSTN32fProcess(r.Context(), n32fContext.N32fURL(), reqMsg)
+	var problemDetails *model.ProblemDetails
+	if errors.As(err, &problemDetails) {
+		logger.Printf("SBI server - remote SEPP rejected N32-f message: %v", problemDetails)
+		problem.Write(w, logger, problemDetails.Status, problemDetails.Cause, problemDetails.Detail, problemDetails.InvalidParams...)
+		return
+	}
+	if err != nil {
+		proxyErrorHandler(logger)(w, r, err)
+		return
+	}
+
+	statusCode, header, rspBody, err := prins.UnprotectResponse(rspMsg, r, prinsContext)
+	if err != nil {
+		logger.Printf("SBI server - invalid N32-f response from remote SEPP: %v", err)
+		background(func(ctx context.Context) {
+			reportN32fError(ctx, logger, n32Client, string(n32fContext.RemoteN32FQDN), prinsContext.N32fContextID, messageID, err)
+		})
+		cause := model.CauseUnspecifiedMsgFailure
+		switch {
+		case errors.Is(err, prins.ErrIntegrityCheckFailed):
+			cause = model.CauseIntegrityCheckFailed
+		case errors.Is(err, prins.ErrModificationsFailed):
+			cause = model.CauseIntegrityCheckOnModificationsFailed
+		case errors.Is(err, prins.ErrPolicyViolation):
+			cause = model.CausePolicyMismatch
+		}
+		problem.Write(w, logger, http.StatusBadGateway, cause, "Invalid response from remote SEPP")
+		return
+	}
+
+	rewriter.rewriteHeader(header)
+	rspBody = rewriter.rewriteBody(header, rspBody)
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(rspBody)))
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(rspBody); err != nil {
+		logger.Printf("SBI server - failed to write response: %v", err)
+	}
+}
+
+// reportN32fError tells the remote SEPP that its response to the N32-f
+// message was rejected, as there is no other way for it to learn it.
+func reportN32fError(ctx context.Context, logger *log.Logger, n32Client *n32.Client, remoteURL string, n32fContextID string, messageID string, err error) {
+	n32fErrorInfo := n32.N32fErrorInfo{
+		N32fMessageId:    messageID,
+		N32fErrorType:    n32.ErrorType(err),
+		N32fContextId:    n32fContextID,
+		ErrorDetailsList: []n32.N32fErrorDetail{{Attribute: "reformattedData", MsgReconstructFailReason: err.Error()}},
+	}
+	if err := n32Client.POSTN32fError(ctx, remoteURL, n32fErrorInfo); err != nil {
+		logger.Printf("SBI server - failed to report N32-f error to remote SEPP: %v", err)
+	}
+}
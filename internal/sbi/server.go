@@ -1,96 +1,273 @@
 package sbi
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
+	"strings"
 	"sync"
 
+	"github.com/dot-5g/sepp/internal/certs"
 	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/problem"
+	"golang.org/x/net/http2"
 )
 
-// dynamicProxyHandler creates a handler function that dynamically decides
-// the target URL based on the current state of seppContext.RemoteN32FQDN.
-func dynamicProxyHandler(seppContext *model.SEPPContext, outboundTLSConfig *tls.Config) http.HandlerFunc {
-	var mu sync.Mutex
-	var reverseProxy *httputil.ReverseProxy
+// peer holds what is needed to forward requests to a remote SEPP.
+type peer struct {
+	remoteSEPP   model.RemoteSEPP
+	reverseProxy *httputil.ReverseProxy
+	n32Client    *n32.Client
+}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		mu.Lock()
-		defer mu.Unlock()
+// newPeer builds the reverse proxy to a remote SEPP on top of the
+// connections owned by its N32 peer. The proxy is not bound to a target:
+// each request carries the one of the N32-f context it is sent over.
+func newPeer(n32Peer *n32.Peer, logger *log.Logger) *peer {
+	return &peer{
+		remoteSEPP: n32Peer.RemoteSEPP,
+		reverseProxy: &httputil.ReverseProxy{
+			Director:       directToN32fTarget,
+			Transport:      n32Peer.Transport,
+			ErrorHandler:   proxyErrorHandler(logger),
+			ErrorLog:       logger,
+			ModifyResponse: rewriteResponse,
+		},
+		n32Client: n32Peer.Client,
+	}
+}
 
-		remoteURL := string(seppContext.RemoteN32FQDN)
-		if remoteURL == "" {
-			http.Error(w, "Remote SEPP not configured", http.StatusInternalServerError)
-			return
-		}
+// peerSource returns the peer of the remote SEPP reachable at url.
+type peerSource interface {
+	get(url string) (*peer, bool)
+}
 
-		if reverseProxy == nil {
-			targetURL, err := url.Parse(remoteURL)
-			if err != nil {
-				http.Error(w, "Failed to parse target URL", http.StatusInternalServerError)
-				return
-			}
-			reverseProxy = httputil.NewSingleHostReverseProxy(targetURL)
-			reverseProxy.Transport = &http.Transport{
-				TLSClientConfig: outboundTLSConfig,
-			}
-			log.Printf("SBI server - forwarding requests to remote SEPP (%s)", remoteURL)
-		} else {
-			log.Printf("SBI server - reusing existing reverse proxy to remote SEPP (%s)", remoteURL)
-		}
+// peerMap is a fixed set of peers keyed by the URL of their remote SEPP.
+type peerMap map[string]*peer
+
+func (m peerMap) get(url string) (*peer, bool) {
+	p, ok := m[url]
+	return p, ok
+}
 
-		reverseProxy.ServeHTTP(w, r)
+// n32Peers builds the peers on top of those of an N32 peer manager as
+// remote SEPPs are added, and rebuilds them when they are replaced.
+type n32Peers struct {
+	manager *n32.PeerManager
+	logger  *log.Logger
+	mu      sync.RWMutex
+	peers   map[*n32.Peer]*peer
+}
+
+func (p *n32Peers) get(url string) (*peer, bool) {
+	n32Peer, ok := p.manager.Get(url)
+	if !ok {
+		return nil, false
+	}
+	p.mu.RLock()
+	cached, ok := p.peers[n32Peer]
+	p.mu.RUnlock()
+	if ok {
+		return cached, true
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, ok := p.peers[n32Peer]; ok {
+		return cached, true
+	}
+	// Peers replaced or removed from the manager are dropped.
+	for known := range p.peers {
+		if current, ok := p.manager.Get(known.RemoteSEPP.URL); !ok || current != known {
+			delete(p.peers, known)
+		}
+	}
+	created := newPeer(n32Peer, p.logger)
+	p.peers[n32Peer] = created
+	p.logger.Printf("SBI server - forwarding requests for PLMN %s-%s to remote SEPP (%s)", n32Peer.RemoteSEPP.PlmnId.Mcc, n32Peer.RemoteSEPP.PlmnId.Mnc, n32Peer.RemoteSEPP.URL)
+	return created, true
 }
 
-func StartServer(address, serverCertPath, serverKeyPath, caCertPath, clientCertPath, clientKeyPath string, seppContext *model.SEPPContext) {
-	caCert, err := os.ReadFile(caCertPath)
-	if err != nil {
-		log.Fatalf("failed to read CA certificate: %v", err)
+type n32fTargetKey struct{}
+
+// directToN32fTarget addresses the outgoing request to the N32-f target
+// stored in its context, keeping the authority of the target NF.
+func directToN32fTarget(req *http.Request) {
+	target := req.Context().Value(n32fTargetKey{}).(*url.URL)
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	if prefix := strings.TrimSuffix(target.Path, "/"); prefix != "" {
+		req.URL.Path = prefix + req.URL.Path
+		req.URL.RawPath = ""
 	}
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		log.Fatal("failed to append CA certificate")
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// Do not let the transport add its own User-Agent.
+		req.Header.Set("User-Agent", "")
 	}
+}
 
-	clientCert, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
-	if err != nil {
-		log.Fatalf("failed to load client certificate and key: %v", err)
+// selectRemoteSEPP picks the roaming partner serving the PLMN of the
+// target NF, named by the target apiRoot if any or else by the
+// authority of the request. A single configured partner is used for
+// every request.
+func selectRemoteSEPP(r *http.Request, apiRoot *url.URL, seppContext *model.SEPPContext) (model.RemoteSEPP, bool) {
+	settings := seppContext.Settings()
+	if apiRoot != nil {
+		if plmnId, ok := model.PlmnIdFromFQDN(apiRoot.Hostname()); ok {
+			return settings.GetRemoteSEPP(plmnId)
+		}
+	}
+	if plmnId, ok := model.PlmnIdFromFQDN(hostname(r.Host)); ok {
+		return settings.GetRemoteSEPP(plmnId)
 	}
+	if len(settings.RemoteSEPPs) == 1 {
+		return settings.RemoteSEPPs[0], true
+	}
+	return model.RemoteSEPP{}, false
+}
+
+// withAuthority returns a copy of r addressed to the foreign NF named by
+// the telescopic FQDN it was sent to.
+func withAuthority(r *http.Request, foreignFQDN string) *http.Request {
+	target := r.Clone(r.Context())
+	target.Host = foreignFQDN
+	target.URL.Host = foreignFQDN
+	return target
+}
 
-	outboundTLSConfig := &tls.Config{
-		RootCAs:      caCertPool,
-		Certificates: []tls.Certificate{clientCert},
+func hostname(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
 	}
+	return host
+}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", dynamicProxyHandler(seppContext, outboundTLSConfig))
+// dynamicProxyHandler creates a handler function that forwards each
+// request to the remote SEPP of the target PLMN over an established
+// N32-f context. Requests to a remote SEPP with which PRINS was
+// negotiated are reformatted and sent over N32-f instead of being
+// proxied as is.
+func dynamicProxyHandler(seppContext *model.SEPPContext, peers peerSource, background Background) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiRoot, err := targetApiRoot(r)
+		if err != nil {
+			problem.Write(w, seppContext.Logger(), http.StatusBadRequest, model.CauseOptionalIeIncorrect, err.Error(), model.InvalidParam{Param: TargetApiRootHeader, Reason: "invalid apiRoot"})
+			return
+		}
+		rewriter := newURIRewriter(seppContext, r)
+		if foreign, ok := foreignFQDN(hostname(r.Host), string(seppContext.Settings().LocalSBIFQDN)); ok {
+			r = withAuthority(r, foreign)
+		}
+		remoteSEPP, ok := selectRemoteSEPP(r, apiRoot, seppContext)
+		if !ok {
+			problem.Write(w, seppContext.Logger(), http.StatusServiceUnavailable, model.CauseTargetNfNotReachable, "No remote SEPP for target PLMN")
+			return
+		}
+		remotePeer, ok := peers.get(remoteSEPP.URL)
+		if !ok {
+			problem.Write(w, seppContext.Logger(), http.StatusServiceUnavailable, model.CauseTargetNfNotReachable, "No remote SEPP for target PLMN")
+			return
+		}
 
-	serverCert, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath)
-	if err != nil {
-		log.Fatalf("failed to load server key pair: %v", err)
+		// The context is looked up for every request so that traffic
+		// follows new handshakes and terminations.
+		n32fContext, ok := seppContext.GetPeerN32fContext(model.FQDN(remoteSEPP.URL))
+		if !ok {
+			problem.Write(w, seppContext.Logger(), http.StatusServiceUnavailable, model.CauseTargetNfNotReachable, "No N32-f context with remote SEPP")
+			return
+		}
+		if n32fContext.SecurityCapability == model.PRINS {
+			// The request line carried over N32-f is the one of the
+			// target NF, the remote SEPP has no use for the header.
+			if apiRoot != nil {
+				r = withTargetApiRoot(r, apiRoot)
+			}
+			forwardPRINS(w, r, n32fContext, remotePeer.n32Client, rewriter, background, seppContext.Logger())
+			return
+		}
+
+		// With TLS the request is proxied as is and the remote SEPP
+		// consumes the header to reach the target NF.
+		target, err := url.Parse(n32fContext.N32fURL())
+		if err != nil {
+			problem.Write(w, seppContext.Logger(), http.StatusServiceUnavailable, model.CauseTargetNfNotReachable, "Invalid N32-f target of remote SEPP")
+			seppContext.Logger().Printf("SBI server - invalid N32-f target %q: %v", n32fContext.N32fURL(), err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), n32fTargetKey{}, target)
+		if rewriter != nil {
+			ctx = context.WithValue(ctx, uriRewriterKey{}, rewriter)
+		}
+		remotePeer.reverseProxy.ServeHTTP(w, r.WithContext(ctx))
 	}
+}
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
-		ClientCAs:    caCertPool,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
+// proxyErrorHandler reports failures to reach the remote SEPP to the
+// Network Function instead of the default empty 502 response.
+func proxyErrorHandler(logger *log.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Printf("SBI server - failed to forward request to remote SEPP: %v", err)
+		problem.Write(w, logger, http.StatusGatewayTimeout, model.CauseTargetNfNotReachable, "Failed to reach remote SEPP")
 	}
+}
+
+// Background runs task outliving the request that started it, with a
+// context done once the SEPP stops.
+type Background func(task func(ctx context.Context))
+
+// Server serves the SBI of the SEPP until it is shut down.
+type Server struct {
+	logger     *log.Logger
+	httpServer *http.Server
+}
+
+// NewServer returns the SBI server, authenticating with the material of
+// store and forwarding the requests of the local NFs to the remote SEPPs
+// over the connections of the peers of manager. Reports of N32-f errors
+// to the remote SEPPs are run by background.
+func NewServer(address string, store *certs.Store, seppContext *model.SEPPContext, manager *n32.PeerManager, background Background) (*Server, error) {
+	logger := seppContext.Logger()
+	peers := &n32Peers{manager: manager, logger: logger, peers: make(map[*n32.Peer]*peer)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", dynamicProxyHandler(seppContext, peers, background))
 
-	server := &http.Server{
+	httpServer := &http.Server{
 		Addr:      address,
 		Handler:   mux,
-		TLSConfig: tlsConfig,
+		TLSConfig: store.ServerTLSConfig(),
+		ErrorLog:  logger,
+	}
+	if err := http2.ConfigureServer(httpServer, &http2.Server{MaxConcurrentStreams: n32.MaxConcurrentStreams}); err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP/2: %w", err)
 	}
+	return &Server{logger: logger, httpServer: httpServer}, nil
+}
 
-	log.Printf("SBI server - started listening on %s", address)
-	if err := server.ListenAndServeTLS(serverCertPath, serverKeyPath); err != nil {
-		log.Fatalf("failed to start server: %v", err)
+// Addr returns the address the server is configured to listen on.
+func (s *Server) Addr() string {
+	return s.httpServer.Addr
+}
+
+// Serve accepts connections on listener until Shutdown is called, after
+// which it returns nil.
+func (s *Server) Serve(listener net.Listener) error {
+	s.logger.Printf("SBI server - started listening on %s", listener.Addr())
+	// The certificate is already part of the TLS configuration.
+	if err := s.httpServer.ServeTLS(listener, "", ""); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("SBI server failed: %w", err)
 	}
-	log.Println("SBI server - stopped")
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for the requests in
+// flight to complete, or for ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	s.logger.Println("SBI server - stopped")
+	return err
 }
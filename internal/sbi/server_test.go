@@ -0,0 +1,163 @@
+package sbi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+)
+
+// goBackground runs tasks without waiting for them, as the tests do not
+// stop a SEPP.
+func goBackground(task func(ctx context.Context)) {
+	go task(context.Background())
+}
+
+func TestGivenPeerStateChangesWhenProxyingThenRequestsFollowLatestContext(t *testing.T) {
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer second.Close()
+
+	remoteSEPP := model.RemoteSEPP{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: first.URL}
+	seppContext := model.NewSEPPContext(model.Settings{RemoteSEPPs: []model.RemoteSEPP{remoteSEPP}})
+	transport := &http.Transport{}
+	peers := peerMap{remoteSEPP.URL: newPeer(&n32.Peer{RemoteSEPP: remoteSEPP, Transport: transport, Client: n32.NewClient(transport, log.Default())}, log.Default())}
+	handler := dynamicProxyHandler(seppContext, peers, goBackground)
+	send := func() int {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-002020000000001/am-data", nil))
+		return rr.Code
+	}
+
+	if code := send(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %d without N32-f context, got %d", http.StatusServiceUnavailable, code)
+	}
+
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0000000000000001", RemoteN32FQDN: model.FQDN(first.URL), SecurityCapability: model.TLS})
+	if code := send(); code != http.StatusOK {
+		t.Errorf("Expected request to reach the N32-c endpoint, got %d", code)
+	}
+
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0000000000000002", RemoteN32FQDN: model.FQDN(first.URL), RemoteN32fURL: second.URL, SecurityCapability: model.TLS})
+	if code := send(); code != http.StatusAccepted {
+		t.Errorf("Expected request to reach the renegotiated N32-f target, got %d", code)
+	}
+
+	seppContext.RemoveN32fContext("0000000000000002")
+	if code := send(); code != http.StatusOK {
+		t.Errorf("Expected request to reach the N32-c endpoint after termination, got %d", code)
+	}
+}
+
+func TestGivenConcurrentRequestsWhenProxyingThenAllAreForwarded(t *testing.T) {
+	release := make(chan struct{})
+	var arrived sync.WaitGroup
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer remote.Close()
+
+	remoteSEPP := model.RemoteSEPP{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: remote.URL}
+	seppContext := model.NewSEPPContext(model.Settings{RemoteSEPPs: []model.RemoteSEPP{remoteSEPP}})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0000000000000001", RemoteN32FQDN: model.FQDN(remote.URL), SecurityCapability: model.TLS})
+	transport := &http.Transport{}
+	peers := peerMap{remoteSEPP.URL: newPeer(&n32.Peer{RemoteSEPP: remoteSEPP, Transport: transport, Client: n32.NewClient(transport, log.Default())}, log.Default())}
+	handler := dynamicProxyHandler(seppContext, peers, goBackground)
+
+	const requests = 4
+	arrived.Add(requests)
+	codes := make(chan int, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-002020000000001/am-data", nil))
+			codes <- rr.Code
+		}()
+	}
+	// Every request must be in flight at the remote SEPP at once.
+	arrived.Wait()
+	close(release)
+
+	for i := 0; i < requests; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Unexpected status code %d", code)
+		}
+	}
+}
+
+// BenchmarkDynamicProxyHandlerParallel forwards requests to a remote SEPP
+// answering after a millisecond. Requests are handled concurrently, so
+// the time per request shrinks as parallelism grows instead of staying
+// at the latency of the remote SEPP.
+func BenchmarkDynamicProxyHandlerParallel(b *testing.B) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer remote.Close()
+
+	remoteSEPP := model.RemoteSEPP{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: remote.URL}
+	seppContext := model.NewSEPPContext(model.Settings{RemoteSEPPs: []model.RemoteSEPP{remoteSEPP}})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0000000000000001", RemoteN32FQDN: model.FQDN(remote.URL), SecurityCapability: model.TLS})
+	transport := &http.Transport{MaxIdleConnsPerHost: 256}
+	defer transport.CloseIdleConnections()
+	peers := peerMap{remoteSEPP.URL: newPeer(&n32.Peer{RemoteSEPP: remoteSEPP, Transport: transport, Client: n32.NewClient(transport, log.Default())}, log.Default())}
+	handler := dynamicProxyHandler(seppContext, peers, goBackground)
+
+	b.SetParallelism(32)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-002020000000001/am-data", nil))
+			if rr.Code != http.StatusOK {
+				b.Errorf("Unexpected status code %d", rr.Code)
+			}
+		}
+	})
+}
+
+// BenchmarkGetPeerN32fContextParallel measures the N32-f context lookup
+// done for every request while handshakes keep updating the contexts.
+func BenchmarkGetPeerN32fContextParallel(b *testing.B) {
+	seppContext := &model.SEPPContext{}
+	for i := 0; i < 16; i++ {
+		seppContext.AddN32fContext(&model.N32fContext{N32fContextID: fmt.Sprintf("%016x", i), RemoteN32FQDN: model.FQDN(fmt.Sprintf("https://sepp%d.example.com", i)), SecurityCapability: model.TLS})
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "ffffffffffffffff", RemoteN32FQDN: "https://sepp0.example.com", SecurityCapability: model.TLS})
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, ok := seppContext.GetPeerN32fContext("https://sepp0.example.com"); !ok {
+				b.Errorf("N32-f context not found")
+			}
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package sbi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TargetApiRootHeader is set by NFs using indirect communication to
+// name the apiRoot of the target NF (TS 29.500 clause 5.2.3.2.4).
+const TargetApiRootHeader = "3gpp-Sbi-Target-apiRoot"
+
+// targetApiRoot returns the apiRoot of the target NF, or nil when the
+// request is addressed directly.
+func targetApiRoot(r *http.Request) (*url.URL, error) {
+	value := r.Header.Get(TargetApiRootHeader)
+	if value == "" {
+		return nil, nil
+	}
+	apiRoot, err := url.Parse(value)
+	if err != nil || (apiRoot.Scheme != "http" && apiRoot.Scheme != "https") || apiRoot.Host == "" {
+		return nil, fmt.Errorf("invalid %s %q", TargetApiRootHeader, value)
+	}
+	return apiRoot, nil
+}
+
+// withTargetApiRoot returns a copy of r addressed to the target NF: the
+// apiRoot of the request URI is replaced by apiRoot and the header,
+// which has then been consumed, is removed (TS 29.500 clause 6.10.2).
+func withTargetApiRoot(r *http.Request, apiRoot *url.URL) *http.Request {
+	target := r.Clone(r.Context())
+	target.URL.Scheme = apiRoot.Scheme
+	target.URL.Host = apiRoot.Host
+	if prefix := strings.TrimSuffix(apiRoot.Path, "/"); prefix != "" {
+		target.URL.Path = prefix + r.URL.Path
+		if r.URL.RawPath != "" {
+			target.URL.RawPath = strings.TrimSuffix(apiRoot.EscapedPath(), "/") + r.URL.RawPath
+		}
+	}
+	target.Host = apiRoot.Host
+	target.Header.Del(TargetApiRootHeader)
+	return target
+}
@@ -0,0 +1,80 @@
+package sbi
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+func TestGivenTargetApiRootWhenSelectRemoteSEPPThenPeerOfTargetPlmnIsSelected(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		RemoteSEPPs: []model.RemoteSEPP{
+			{PlmnId: model.PlmnId{Mcc: "001", Mnc: "01"}, URL: "https://sepp.5gc.mnc001.mcc001.3gppnetwork.org"},
+			{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: "https://sepp.5gc.mnc002.mcc002.3gppnetwork.org"},
+		},
+	})
+	r := httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-002020000000001/am-data", nil)
+	r.Header.Set(TargetApiRootHeader, "https://nudm.5gc.mnc002.mcc002.3gppnetwork.org")
+
+	apiRoot, err := targetApiRoot(r)
+	if err != nil {
+		t.Fatalf("Failed to parse target apiRoot: %v", err)
+	}
+	remoteSEPP, ok := selectRemoteSEPP(r, apiRoot, seppContext)
+
+	if !ok || remoteSEPP.URL != "https://sepp.5gc.mnc002.mcc002.3gppnetwork.org" {
+		t.Errorf("Unexpected remote SEPP %+v", remoteSEPP)
+	}
+}
+
+func TestGivenUnknownTargetPlmnWhenSelectRemoteSEPPThenNoPeerIsSelected(t *testing.T) {
+	seppContext := model.NewSEPPContext(model.Settings{
+		RemoteSEPPs: []model.RemoteSEPP{
+			{PlmnId: model.PlmnId{Mcc: "001", Mnc: "01"}, URL: "https://sepp.5gc.mnc001.mcc001.3gppnetwork.org"},
+		},
+	})
+	r := httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-003030000000001/am-data", nil)
+	r.Header.Set(TargetApiRootHeader, "https://nudm.5gc.mnc003.mcc003.3gppnetwork.org")
+
+	apiRoot, err := targetApiRoot(r)
+	if err != nil {
+		t.Fatalf("Failed to parse target apiRoot: %v", err)
+	}
+	if remoteSEPP, ok := selectRemoteSEPP(r, apiRoot, seppContext); ok {
+		t.Errorf("Expected no remote SEPP, got %+v", remoteSEPP)
+	}
+}
+
+func TestGivenInvalidTargetApiRootWhenTargetApiRootThenErrorIsReturned(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-001010000000001/am-data", nil)
+	r.Header.Set(TargetApiRootHeader, "nudm.5gc.mnc001.mcc001.3gppnetwork.org")
+
+	if _, err := targetApiRoot(r); err == nil {
+		t.Errorf("Expected invalid target apiRoot error")
+	}
+}
+
+func TestGivenTargetApiRootWhenWithTargetApiRootThenRequestIsAddressedToTargetNF(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://sepp.local/nudm-sdm/v2/imsi-001010000000001/am-data?dataset-names=AM", nil)
+	r.Header.Set(TargetApiRootHeader, "https://nudm.5gc.mnc001.mcc001.3gppnetwork.org:8443/prefix")
+	apiRoot, err := targetApiRoot(r)
+	if err != nil {
+		t.Fatalf("Failed to parse target apiRoot: %v", err)
+	}
+
+	target := withTargetApiRoot(r, apiRoot)
+
+	if target.URL.String() != "https://nudm.5gc.mnc001.mcc001.3gppnetwork.org:8443/prefix/nudm-sdm/v2/imsi-001010000000001/am-data?dataset-names=AM" {
+		t.Errorf("Unexpected target URL %s", target.URL)
+	}
+	if target.Host != "nudm.5gc.mnc001.mcc001.3gppnetwork.org:8443" {
+		t.Errorf("Unexpected target host %s", target.Host)
+	}
+	if target.Header.Get(TargetApiRootHeader) != "" {
+		t.Errorf("Expected %s header to be removed", TargetApiRootHeader)
+	}
+	if r.Header.Get(TargetApiRootHeader) == "" {
+		t.Errorf("Original request was modified")
+	}
+}
@@ -0,0 +1,180 @@
+package sbi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+// callbackURIFields are the JSON attributes of SBI messages holding URIs
+// a foreign NF is called back on.
+var callbackURIFields = map[string]bool{
+	"callbackUri":             true,
+	"callbackReference":       true,
+	"notifyUri":               true,
+	"notificationUri":         true,
+	"nfStatusNotificationUri": true,
+}
+
+// foreignFQDN extracts the FQDN of the foreign NF from a telescopic FQDN
+// of this SEPP such as nf1.5gc.mnc002.mcc002.3gppnetwork.org.sepp.example.com
+// (TS 29.500 clause 6.1.4.3).
+func foreignFQDN(fqdn string, localFQDN string) (string, bool) {
+	if localFQDN == "" {
+		return "", false
+	}
+	fqdn = strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	suffix := "." + strings.ToLower(localFQDN)
+	if !strings.HasSuffix(fqdn, suffix) || len(fqdn) == len(suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(fqdn, suffix), true
+}
+
+// uriRewriter replaces the URIs of foreign NFs in responses with
+// telescopic FQDNs of this SEPP, so that NFs keep going through it.
+type uriRewriter struct {
+	localFQDN string
+	port      string
+}
+
+// newURIRewriter returns a rewriter producing URIs on the authority the
+// NF used to reach this SEPP, or nil when no SBI FQDN is configured.
+func newURIRewriter(seppContext *model.SEPPContext, r *http.Request) *uriRewriter {
+	if seppContext.Settings().LocalSBIFQDN == "" {
+		return nil
+	}
+	_, port, _ := net.SplitHostPort(r.Host)
+	return &uriRewriter{localFQDN: string(seppContext.Settings().LocalSBIFQDN), port: port}
+}
+
+func (rw *uriRewriter) rewriteURI(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri, false
+	}
+	if _, ok := model.PlmnIdFromFQDN(u.Hostname()); !ok {
+		return uri, false
+	}
+	if _, ok := foreignFQDN(u.Hostname(), rw.localFQDN); ok {
+		return uri, false
+	}
+	host := u.Hostname() + "." + rw.localFQDN
+	if rw.port != "" {
+		host = net.JoinHostPort(host, rw.port)
+	}
+	u.Scheme = "https"
+	u.Host = host
+	return u.String(), true
+}
+
+func (rw *uriRewriter) rewriteHeader(header http.Header) {
+	if rw == nil {
+		return
+	}
+	for _, name := range []string{"Location", "Content-Location"} {
+		if value := header.Get(name); value != "" {
+			if rewritten, ok := rw.rewriteURI(value); ok {
+				header.Set(name, rewritten)
+			}
+		}
+	}
+}
+
+// maxRewrittenBodySize bounds the bodies read in memory to rewrite their
+// callback URIs. Larger bodies are proxied unchanged.
+const maxRewrittenBodySize = 1 << 20
+
+// rewritableBody tells whether a body with header is plain JSON, the only
+// bodies whose callback URIs are rewritten.
+func rewritableBody(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// rewriteBody rewrites the callback URIs of a JSON body. Other bodies
+// are returned unchanged.
+func (rw *uriRewriter) rewriteBody(header http.Header, body []byte) []byte {
+	if rw == nil || len(body) == 0 || !rewritableBody(header) {
+		return body
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return body
+	}
+	if !rw.rewriteValue(document) {
+		return body
+	}
+	rewritten, err := json.Marshal(document)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+func (rw *uriRewriter) rewriteValue(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if uri, ok := child.(string); ok && callbackURIFields[key] {
+				if rewritten, ok := rw.rewriteURI(uri); ok {
+					v[key] = rewritten
+					changed = true
+				}
+				continue
+			}
+			changed = rw.rewriteValue(child) || changed
+		}
+	case []interface{}:
+		for _, child := range v {
+			changed = rw.rewriteValue(child) || changed
+		}
+	}
+	return changed
+}
+
+// rewriteResponse applies the rewriter attached to the request context
+// to a response proxied from the remote SEPP.
+func rewriteResponse(resp *http.Response) error {
+	rw, _ := resp.Request.Context().Value(uriRewriterKey{}).(*uriRewriter)
+	if rw == nil {
+		return nil
+	}
+	rw.rewriteHeader(resp.Header)
+	if resp.Body == nil || resp.Body == http.NoBody || !rewritableBody(resp.Header) {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRewrittenBodySize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxRewrittenBodySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+	body = rw.rewriteBody(resp.Header, body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+type uriRewriterKey struct{}
@@ -0,0 +1,138 @@
+package sbi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dot-5g/sepp/internal/model"
+)
+
+func TestGivenTelescopicFQDNWhenForeignFQDNThenForeignLabelIsReturned(t *testing.T) {
+	foreign, ok := foreignFQDN("nf1.5gc.mnc002.mcc002.3gppnetwork.org.sepp.5gc.mnc001.mcc001.3gppnetwork.org", "sepp.5gc.mnc001.mcc001.3gppnetwork.org")
+
+	if !ok || foreign != "nf1.5gc.mnc002.mcc002.3gppnetwork.org" {
+		t.Errorf("Unexpected foreign FQDN %q", foreign)
+	}
+}
+
+func TestGivenLocalFQDNWhenForeignFQDNThenNothingIsReturned(t *testing.T) {
+	if foreign, ok := foreignFQDN("sepp.5gc.mnc001.mcc001.3gppnetwork.org", "sepp.5gc.mnc001.mcc001.3gppnetwork.org"); ok {
+		t.Errorf("Expected no foreign FQDN, got %q", foreign)
+	}
+}
+
+func TestGivenTelescopicFQDNWhenProxyingThenRequestIsRoutedAndResponseURIsAreTelescopic(t *testing.T) {
+	var receivedHost string
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHost = r.Host
+		w.Header().Set("Location", "https://nf1.5gc.mnc002.mcc002.3gppnetwork.org/nudm-sdm/v2/subscriptions/1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"callbackReference":"https://nf1.5gc.mnc002.mcc002.3gppnetwork.org/notify","nfInstanceId":"1"}`))
+	}))
+	defer remote.Close()
+	remoteURL, _ := url.Parse(remote.URL)
+	reverseProxy := httputil.NewSingleHostReverseProxy(remoteURL)
+	reverseProxy.ModifyResponse = rewriteResponse
+
+	remoteSEPP := model.RemoteSEPP{PlmnId: model.PlmnId{Mcc: "002", Mnc: "02"}, URL: remote.URL}
+	seppContext := model.NewSEPPContext(model.Settings{
+		LocalSBIFQDN: "sepp.5gc.mnc001.mcc001.3gppnetwork.org",
+		RemoteSEPPs: []model.RemoteSEPP{
+			{PlmnId: model.PlmnId{Mcc: "003", Mnc: "03"}, URL: "https://unused.example.com"},
+			remoteSEPP,
+		},
+	})
+	seppContext.AddN32fContext(&model.N32fContext{N32fContextID: "0123456789abcdef", RemoteN32FQDN: model.FQDN(remote.URL), SecurityCapability: model.TLS})
+	handler := dynamicProxyHandler(seppContext, peerMap{remote.URL: {remoteSEPP: remoteSEPP, reverseProxy: reverseProxy}}, goBackground)
+
+	req := httptest.NewRequest("POST", "https://nf1.5gc.mnc002.mcc002.3gppnetwork.org.sepp.5gc.mnc001.mcc001.3gppnetwork.org:1232/nudm-sdm/v2/imsi-002020000000001/sdm-subscriptions", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	if receivedHost != "nf1.5gc.mnc002.mcc002.3gppnetwork.org" {
+		t.Errorf("Remote SEPP received host %q", receivedHost)
+	}
+	expectedLocation := "https://nf1.5gc.mnc002.mcc002.3gppnetwork.org.sepp.5gc.mnc001.mcc001.3gppnetwork.org:1232/nudm-sdm/v2/subscriptions/1"
+	if location := rr.Header().Get("Location"); location != expectedLocation {
+		t.Errorf("Unexpected Location %q", location)
+	}
+	body, _ := io.ReadAll(rr.Body)
+	var document map[string]interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if document["callbackReference"] != "https://nf1.5gc.mnc002.mcc002.3gppnetwork.org.sepp.5gc.mnc001.mcc001.3gppnetwork.org:1232/notify" {
+		t.Errorf("Unexpected callbackReference %v", document["callbackReference"])
+	}
+}
+
+// unreadBody fails the test it belongs to when it is read.
+type unreadBody struct {
+	t *testing.T
+}
+
+func (b unreadBody) Read([]byte) (int, error) {
+	b.t.Errorf("Response body was read")
+	return 0, io.EOF
+}
+
+func (b unreadBody) Close() error {
+	return nil
+}
+
+func responseWithRewriter(header http.Header, body io.ReadCloser) *http.Response {
+	rw := &uriRewriter{localFQDN: "sepp.5gc.mnc001.mcc001.3gppnetwork.org"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), uriRewriterKey{}, rw))
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: body, ContentLength: -1, Request: req}
+}
+
+func TestGivenNonJSONResponseWhenRewriteResponseThenBodyIsNotRead(t *testing.T) {
+	for _, header := range []http.Header{
+		{"Content-Type": {"application/octet-stream"}},
+		{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}},
+	} {
+		body := unreadBody{t: t}
+		resp := responseWithRewriter(header, body)
+
+		if err := rewriteResponse(resp); err != nil {
+			t.Fatalf("Failed to rewrite response: %v", err)
+		}
+
+		if resp.Body != body || resp.ContentLength != -1 {
+			t.Errorf("Body of response with %v was replaced", header)
+		}
+	}
+}
+
+func TestGivenOversizedJSONResponseWhenRewriteResponseThenBodyIsProxiedUnchanged(t *testing.T) {
+	document := `{"callbackReference":"https://nf1.5gc.mnc002.mcc002.3gppnetwork.org/notify","padding":"` + strings.Repeat("a", maxRewrittenBodySize) + `"}`
+	resp := responseWithRewriter(http.Header{"Content-Type": {"application/json"}}, io.NopCloser(strings.NewReader(document)))
+
+	if err := rewriteResponse(resp); err != nil {
+		t.Fatalf("Failed to rewrite response: %v", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+	if !bytes.Equal(body, []byte(document)) {
+		t.Errorf("Oversized body was modified")
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("Unexpected Content-Length %d", resp.ContentLength)
+	}
+}
@@ -0,0 +1,281 @@
+// Package pki issues the CA and certificates used by SEPPs on their N32
+// and SBI interfaces.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// KeyType is the algorithm of a generated private key.
+type KeyType string
+
+const (
+	ECDSAP256 KeyType = "ecdsa-p256"
+	RSA2048   KeyType = "rsa-2048"
+)
+
+// KeyTypes lists the supported key types.
+var KeyTypes = []KeyType{ECDSAP256, RSA2048}
+
+// DefaultValidity is the validity of certificates issued without one.
+const DefaultValidity = 365 * 24 * time.Hour
+
+// File names of the certificates of a SEPP, as found in the sample
+// configurations.
+const (
+	CACertFile        = "ca.crt"
+	CAKeyFile         = "ca.key"
+	N32ServerName     = "n32Server"
+	SBIServerName     = "sbiServer"
+	N32ClientName     = "client"
+	certFileExtension = ".crt"
+	keyFileExtension  = ".key"
+)
+
+// SEPPNames lists the names of the certificates of a SEPP, the N32 and
+// SBI server certificates and the N32 client certificate.
+var SEPPNames = []string{N32ServerName, SBIServerName, N32ClientName}
+
+var commonNames = map[string]string{
+	N32ServerName: "N32 Server",
+	SBIServerName: "SBI Server",
+	N32ClientName: "Client",
+}
+
+// Options describe a certificate to issue.
+type Options struct {
+	CommonName string
+	// Hosts are the DNS names and IP addresses the certificate is valid
+	// for.
+	Hosts    []string
+	KeyType  KeyType
+	Validity time.Duration
+}
+
+// SEPPOptions describe the certificates of a SEPP. The N32 server and
+// client certificates are valid for N32Hosts, the SBI server certificate
+// for SBIHosts.
+type SEPPOptions struct {
+	N32Hosts []string
+	SBIHosts []string
+	KeyType  KeyType
+	Validity time.Duration
+}
+
+// hosts returns the hosts the certificate named name is valid for.
+func (opts SEPPOptions) hosts(name string) []string {
+	if name == SBIServerName {
+		return opts.SBIHosts
+	}
+	return opts.N32Hosts
+}
+
+// KeyPair is a certificate and its private key.
+type KeyPair struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// SEPPFQDN returns the FQDN of the SEPP of a PLMN, as defined by TS
+// 23.003, such as sepp.5gc.mnc001.mcc001.3gppnetwork.org.
+func SEPPFQDN(mcc string, mnc string) string {
+	if len(mnc) == 2 {
+		mnc = "0" + mnc
+	}
+	return fmt.Sprintf("sepp.5gc.mnc%s.mcc%s.3gppnetwork.org", mnc, mcc)
+}
+
+// NewCA generates a self-signed CA.
+func NewCA(opts Options) (*KeyPair, error) {
+	key, err := generateKey(opts.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = nil
+	return create(template, template, key.Public(), key, key)
+}
+
+// Issue generates a certificate signed by ca, usable by both servers and
+// clients.
+func (ca *KeyPair) Issue(opts Options) (*KeyPair, error) {
+	if !ca.Certificate.IsCA {
+		return nil, fmt.Errorf("certificate %s is not a CA", ca.Certificate.Subject.CommonName)
+	}
+	key, err := generateKey(opts.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	return create(template, ca.Certificate, key.Public(), ca.Key, key)
+}
+
+// IssueSEPP issues the certificates of a SEPP named by names, SEPPNames
+// if none, and writes them to dir with the certificate of ca.
+func (ca *KeyPair) IssueSEPP(dir string, opts SEPPOptions, names ...string) error {
+	if len(names) == 0 {
+		names = SEPPNames
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := WriteCertificate(filepath.Join(dir, CACertFile), ca.Certificate); err != nil {
+		return err
+	}
+	for _, name := range names {
+		commonName, ok := commonNames[name]
+		if !ok {
+			return fmt.Errorf("unknown SEPP certificate %s, supported values are %v", name, SEPPNames)
+		}
+		keyPair, err := ca.Issue(Options{CommonName: commonName, Hosts: opts.hosts(name), KeyType: opts.KeyType, Validity: opts.Validity})
+		if err != nil {
+			return fmt.Errorf("failed to issue %s certificate: %w", name, err)
+		}
+		if err := keyPair.WriteFiles(filepath.Join(dir, name+certFileExtension), filepath.Join(dir, name+keyFileExtension)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads a key pair written by WriteFiles.
+func Load(certPath string, keyPath string) (*KeyPair, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate %s: %w", certPath, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found in %s", keyPath)
+	}
+	key, err := parseKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %w", keyPath, err)
+	}
+	return &KeyPair{Certificate: cert, Key: key}, nil
+}
+
+// WriteFiles writes the certificate and the private key as PEM, the key
+// being readable by its owner only.
+func (k *KeyPair) WriteFiles(certPath string, keyPath string) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(k.Key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	if err := WriteCertificate(certPath, k.Certificate); err != nil {
+		return err
+	}
+	return os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
+
+// WriteCertificate writes cert as PEM.
+func WriteCertificate(path string, cert *x509.Certificate) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o644)
+}
+
+func generateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case ECDSAP256, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, fmt.Errorf("unsupported key type %s, supported values are %v", keyType, KeyTypes)
+}
+
+func parseKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	return signer, nil
+}
+
+func newTemplate(opts Options) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	validity := opts.Validity
+	if validity == 0 {
+		validity = DefaultValidity
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: opts.CommonName},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	return template, nil
+}
+
+func create(template *x509.Certificate, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer, key crypto.Signer) (*KeyPair, error) {
+	certDER, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return &KeyPair{Certificate: cert, Key: key}, nil
+}
@@ -0,0 +1,131 @@
+package pki_test
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dot-5g/sepp/pkg/pki"
+)
+
+func TestGivenPLMNWhenSEPPFQDNThenMNCIsPadded(t *testing.T) {
+	fqdn := pki.SEPPFQDN("001", "01")
+
+	if fqdn != "sepp.5gc.mnc001.mcc001.3gppnetwork.org" {
+		t.Errorf("Expected 'sepp.5gc.mnc001.mcc001.3gppnetwork.org', got '%s'", fqdn)
+	}
+}
+
+func TestGivenCAWhenIssueSEPPThenCertificatesVerifyAgainstCA(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := pki.NewCA(pki.Options{CommonName: "CA"})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	hosts := []string{"127.0.0.1", pki.SEPPFQDN("001", "01")}
+
+	if err := ca.IssueSEPP(dir, pki.SEPPOptions{N32Hosts: hosts, SBIHosts: hosts, Validity: time.Hour}); err != nil {
+		t.Fatalf("Failed to issue SEPP certificates: %v", err)
+	}
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.Certificate)
+	for _, name := range pki.SEPPNames {
+		keyPair, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"))
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+		cert := keyPair.Leaf
+		if cert == nil {
+			cert, _ = x509.ParseCertificate(keyPair.Certificate[0])
+		}
+		opts := x509.VerifyOptions{Roots: caPool, DNSName: pki.SEPPFQDN("001", "01"), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+		if _, err := cert.Verify(opts); err != nil {
+			t.Errorf("Expected %s to verify against the CA, got %v", name, err)
+		}
+		if cert.NotAfter.After(time.Now().Add(time.Hour)) {
+			t.Errorf("Expected %s to expire within the hour, got %v", name, cert.NotAfter)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, pki.CACertFile)); err != nil {
+		t.Errorf("Expected the CA certificate to be written, got %v", err)
+	}
+}
+
+func TestGivenSeparateHostsWhenIssueSEPPThenEachCertificateHasItsOwn(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := pki.NewCA(pki.Options{CommonName: "CA"})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	if err := ca.IssueSEPP(dir, pki.SEPPOptions{N32Hosts: []string{"sepp.example.com"}, SBIHosts: []string{"sepp.internal"}, Validity: time.Hour}); err != nil {
+		t.Fatalf("Failed to issue SEPP certificates: %v", err)
+	}
+
+	expected := map[string]string{pki.N32ServerName: "sepp.example.com", pki.N32ClientName: "sepp.example.com", pki.SBIServerName: "sepp.internal"}
+	for name, host := range expected {
+		keyPair, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"))
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", name, err)
+		}
+		cert, _ := x509.ParseCertificate(keyPair.Certificate[0])
+		if len(cert.DNSNames) != 1 || cert.DNSNames[0] != host {
+			t.Errorf("Expected %s to be valid for %s only, got %v", name, host, cert.DNSNames)
+		}
+	}
+}
+
+func TestGivenRSAKeyTypeWhenWriteAndLoadThenRSAKeyIsReturned(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := pki.NewCA(pki.Options{CommonName: "CA", KeyType: pki.RSA2048})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	certPath, keyPath := filepath.Join(dir, pki.CACertFile), filepath.Join(dir, pki.CAKeyFile)
+	if err := ca.WriteFiles(certPath, keyPath); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+
+	loaded, err := pki.Load(certPath, keyPath)
+
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+	if _, ok := loaded.Key.(*rsa.PrivateKey); !ok || !loaded.Certificate.IsCA {
+		t.Errorf("Expected an RSA CA, got key %T", loaded.Key)
+	}
+	if _, err := loaded.Issue(pki.Options{CommonName: "N32 Server"}); err != nil {
+		t.Errorf("Expected the loaded CA to issue certificates, got %v", err)
+	}
+}
+
+func TestGivenLeafWhenIssueThenErrorIsReturned(t *testing.T) {
+	ca, err := pki.NewCA(pki.Options{CommonName: "CA"})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	leaf, err := ca.Issue(pki.Options{CommonName: "Client"})
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+
+	_, err = leaf.Issue(pki.Options{CommonName: "Other"})
+
+	if err == nil || !strings.Contains(err.Error(), "is not a CA") {
+		t.Errorf("Expected not a CA error, got %v", err)
+	}
+}
+
+func TestGivenUnsupportedKeyTypeWhenNewCAThenErrorIsReturned(t *testing.T) {
+	_, err := pki.NewCA(pki.Options{CommonName: "CA", KeyType: "dsa"})
+
+	if err == nil || !strings.Contains(err.Error(), "unsupported key type dsa") {
+		t.Errorf("Expected unsupported key type error, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package sepp
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dot-5g/sepp/config"
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/prins"
+)
+
+func newSEPPContext(conf config.Config, logger *log.Logger) (*model.SEPPContext, error) {
+	settings, err := newSettings(conf)
+	if err != nil {
+		return nil, err
+	}
+	seppContext := model.NewSEPPContext(settings)
+	seppContext.Log = logger
+	return seppContext, nil
+}
+
+// newSettings returns the parts of the configuration that are applied
+// without a restart.
+func newSettings(conf config.Config) (model.Settings, error) {
+	supportedSecurityCapabilities := make([]model.SecurityCapability, 0, len(conf.SEPP.SecurityCapabilities))
+	for _, securityCapability := range conf.SEPP.SecurityCapabilities {
+		supportedSecurityCapabilities = append(supportedSecurityCapabilities, model.SecurityCapability(securityCapability))
+	}
+	ipxProviderSecInfoList, err := ipxProviderSecInfoList(conf.SEPP.PRINS.IpxProviders)
+	if err != nil {
+		return model.Settings{}, fmt.Errorf("failed to read IPX provider certificates: %w", err)
+	}
+	return model.Settings{
+		LocalN32FQDN:                  model.FQDN(conf.SEPP.Local.N32.FQDN),
+		LocalSBIFQDN:                  model.FQDN(conf.SEPP.Local.SBI.FQDN),
+		RemoteSEPPs:                   remoteSEPPs(conf.SEPP.Remotes),
+		SupportedSecurityCapabilities: supportedSecurityCapabilities,
+		ProtectionPolicy:              protectionPolicy(conf.SEPP.PRINS),
+		JweCipherSuites:               cipherSuites(conf.SEPP.PRINS.JweCipherSuites, prins.SupportedJweCipherSuites),
+		JwsCipherSuites:               cipherSuites(conf.SEPP.PRINS.JwsCipherSuites, prins.SupportedJwsCipherSuites),
+		IpxProviderSecInfoList:        ipxProviderSecInfoList,
+	}, nil
+}
+
+func remoteSEPPs(remotes []config.Remote) []model.RemoteSEPP {
+	remoteSEPPs := make([]model.RemoteSEPP, 0, len(remotes))
+	for _, remote := range remotes {
+		remoteSEPPs = append(remoteSEPPs, model.RemoteSEPP{
+			PlmnId:     plmnId(remote.PlmnID),
+			URL:        remote.URL,
+			ClientCert: remote.TLS.Cert,
+			ClientKey:  remote.TLS.Key,
+			CA:         remote.TLS.CA,
+		})
+	}
+	return remoteSEPPs
+}
+
+func plmnId(plmnID config.PlmnID) model.PlmnId {
+	return model.PlmnId{Mcc: plmnID.MCC, Mnc: plmnID.MNC}
+}
+
+func localRoutes(routes []config.Route) []model.LocalRoute {
+	localRoutes := make([]model.LocalRoute, 0, len(routes))
+	for _, route := range routes {
+		localRoutes = append(localRoutes, model.LocalRoute{ApiPrefix: route.ApiPrefix, ApiRoot: route.ApiRoot, H2C: route.H2C})
+	}
+	return localRoutes
+}
+
+func cipherSuites(configured []string, supported []string) []string {
+	if len(configured) == 0 {
+		return supported
+	}
+	return configured
+}
+
+func ipxProviderSecInfoList(ipxProviders []config.IpxProvider) ([]model.IpxProviderSecInfo, error) {
+	ipxProviderSecInfoList := make([]model.IpxProviderSecInfo, 0, len(ipxProviders))
+	for _, ipxProvider := range ipxProviders {
+		ipxProviderSecInfo := model.IpxProviderSecInfo{IpxProviderId: ipxProvider.ID}
+		for _, certificatePath := range ipxProvider.Certificates {
+			certificate, err := os.ReadFile(certificatePath)
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %w", certs.ErrCertLoad, certificatePath, err)
+			}
+			ipxProviderSecInfo.CertificateList = append(ipxProviderSecInfo.CertificateList, string(certificate))
+		}
+		ipxProviderSecInfoList = append(ipxProviderSecInfoList, ipxProviderSecInfo)
+	}
+	return ipxProviderSecInfoList, nil
+}
+
+func protectionPolicy(prinsConfig config.PRINS) model.ProtectionPolicy {
+	policy := model.ProtectionPolicy{}
+	for _, ieType := range prinsConfig.DataTypeEncPolicy {
+		policy.DataTypeEncPolicy = append(policy.DataTypeEncPolicy, model.IeType(ieType))
+	}
+	for _, mapping := range prinsConfig.ApiIeMappingList {
+		apiIeMapping := model.ApiIeMapping{
+			ApiSignature: model.ApiSignature{Uri: mapping.ApiSignature},
+			ApiMethod:    mapping.ApiMethod,
+		}
+		for _, ie := range mapping.IeList {
+			apiIeMapping.IeList = append(apiIeMapping.IeList, model.IeInfo{
+				IeLoc:  model.IeLocation(ie.IeLoc),
+				IeType: model.IeType(ie.IeType),
+				ReqIe:  ie.ReqIe,
+				RspIe:  ie.RspIe,
+			})
+		}
+		policy.ApiIeMappingList = append(policy.ApiIeMappingList, apiIeMapping)
+	}
+	return policy
+}
@@ -0,0 +1,160 @@
+package sepp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/prins"
+)
+
+// terminateN32fContexts asks the remote SEPPs to delete the N32-f
+// contexts established with them.
+func terminateN32fContexts(ctx context.Context, seppContext *model.SEPPContext, n32Peers *n32.PeerManager) {
+	var wg sync.WaitGroup
+	for _, remoteSEPP := range seppContext.Settings().RemoteSEPPs {
+		n32Peer, ok := n32Peers.Get(remoteSEPP.URL)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(n32Peer *n32.Peer) {
+			defer wg.Done()
+			terminatePeerN32fContexts(ctx, seppContext, n32Peer)
+		}(n32Peer)
+	}
+	wg.Wait()
+}
+
+// terminatePeerN32fContexts asks the remote SEPP of n32Peer to delete the
+// N32-f contexts established with it.
+func terminatePeerN32fContexts(ctx context.Context, seppContext *model.SEPPContext, n32Peer *n32.Peer) {
+	remoteURL := n32Peer.RemoteSEPP.URL
+	for _, n32fContext := range seppContext.ListN32fContexts() {
+		if string(n32fContext.RemoteN32FQDN) != remoteURL {
+			continue
+		}
+		if err := n32Peer.Client.POSTN32fTerminate(ctx, remoteURL, n32fContext.N32fContextID); err != nil {
+			seppContext.Logger().Printf("Failed to terminate N32-f context %s: %v", n32fContext.N32fContextID, err)
+			continue
+		}
+		seppContext.RemoveN32fContext(n32fContext.N32fContextID)
+	}
+}
+
+func exchangeCapability(ctx context.Context, n32Peer *n32.Peer, fqdn string, seppContext *model.SEPPContext) {
+	remoteURL := n32Peer.RemoteSEPP.URL
+	seppClient := n32Peer.Client
+	for ctx.Err() == nil {
+		if _, ok := seppContext.GetPeerN32fContext(model.FQDN(remoteURL)); ok {
+			return
+		}
+		supportedSecurityCapabilities := seppContext.Settings().SupportedSecurityCapabilities
+		reqData := n32.SecNegotiateReqData{
+			Sender:                     model.FQDN(fqdn),
+			SupportedSecCapabilityList: supportedSecurityCapabilities,
+		}
+		secNegotiateRspData, tlsState, err := seppClient.POSTExchangeCapability(ctx, remoteURL, reqData)
+		if err != nil {
+			seppContext.Logger().Printf("Failed to exchange capability with %s: %v", remoteURL, err)
+			retryAfter(ctx, 5*time.Second)
+			continue
+		}
+		if !slices.Contains(supportedSecurityCapabilities, secNegotiateRspData.SelectedSecCapability) {
+			seppContext.Logger().Printf("Failed to exchange capability: remote SEPP selected unsupported capability %s", secNegotiateRspData.SelectedSecCapability)
+			retryAfter(ctx, 5*time.Second)
+			continue
+		}
+		// The context is keyed by the URL dialed, the sender chosen by
+		// the remote SEPP must only name that same SEPP.
+		if remoteSEPP, ok := seppContext.Settings().GetRemoteSEPPByFQDN(secNegotiateRspData.Sender); !ok || remoteSEPP.URL != remoteURL {
+			seppContext.Logger().Printf("Failed to exchange capability: %s answered as %s", remoteURL, secNegotiateRspData.Sender)
+			retryAfter(ctx, 5*time.Second)
+			continue
+		}
+		n32fContext, err := n32.NewN32fContext(tlsState, model.FQDN(remoteURL), secNegotiateRspData.SelectedSecCapability, true, seppContext)
+		if err != nil {
+			seppContext.Logger().Printf("Failed to establish N32-f context: %v", err)
+			retryAfter(ctx, 5*time.Second)
+			continue
+		}
+		n32fContext.RemoteN32fURL = n32.N32fTargetURL(secNegotiateRspData.SenderN32fFqdn, secNegotiateRspData.SenderN32fPortList)
+		// A PRINS context is only used once its parameters are agreed,
+		// the remote SEPP is told to forget it otherwise.
+		if n32fContext.SecurityCapability == model.PRINS {
+			if err := exchangeParams(ctx, seppClient, remoteURL, fqdn, n32fContext, seppContext.Settings()); err != nil {
+				seppContext.Logger().Printf("Failed to exchange PRINS parameters: %v", err)
+				if err := seppClient.POSTN32fTerminate(ctx, remoteURL, n32fContext.N32fContextID); err != nil {
+					seppContext.Logger().Printf("Failed to terminate N32-f context %s: %v", n32fContext.N32fContextID, err)
+				}
+				retryAfter(ctx, 5*time.Second)
+				continue
+			}
+		}
+		seppContext.AddN32fContext(n32fContext)
+		return
+	}
+}
+
+// retryAfter waits for delay unless ctx is done first.
+func retryAfter(ctx context.Context, delay time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
+
+// exchangeParams runs the cipher suite negotiation, the protection policy
+// exchange and the IPX security information exchange of an N32-f context
+// in that order, recording their outcome in its PRINS context. The N32-f
+// context must not be in use yet.
+func exchangeParams(ctx context.Context, seppClient *n32.Client, remoteURL string, fqdn string, n32fContext *model.N32fContext, settings *model.Settings) error {
+	n32fContextID := n32fContext.N32fContextID
+	prinsContext := n32fContext.PRINS
+	rspData, err := seppClient.POSTExchangeParams(ctx, remoteURL, n32.SecParamExchReqData{
+		N32fContextId:      n32fContextID,
+		JweCipherSuiteList: settings.JweCipherSuites,
+		JwsCipherSuiteList: settings.JwsCipherSuites,
+		Sender:             model.FQDN(fqdn),
+	})
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(settings.JweCipherSuites, rspData.SelectedJweCipherSuite) || !slices.Contains(settings.JwsCipherSuites, rspData.SelectedJwsCipherSuite) {
+		return fmt.Errorf("remote SEPP selected unsupported cipher suites %s and %s", rspData.SelectedJweCipherSuite, rspData.SelectedJwsCipherSuite)
+	}
+	prinsContext.JweCipherSuite = rspData.SelectedJweCipherSuite
+	prinsContext.JwsCipherSuite = rspData.SelectedJwsCipherSuite
+
+	localPolicy := settings.ProtectionPolicy
+	rspData, err = seppClient.POSTExchangeParams(ctx, remoteURL, n32.SecParamExchReqData{
+		N32fContextId:        n32fContextID,
+		ProtectionPolicyInfo: &localPolicy,
+		Sender:               model.FQDN(fqdn),
+	})
+	if err != nil {
+		return err
+	}
+	if rspData.SelProtectionPolicyInfo == nil {
+		return fmt.Errorf("remote SEPP did not return its protection policy")
+	}
+	prinsContext.ProtectionPolicy = prins.MergeProtectionPolicies(localPolicy, *rspData.SelProtectionPolicyInfo)
+
+	localIpxProviders := append([]model.IpxProviderSecInfo{}, settings.IpxProviderSecInfoList...)
+	rspData, err = seppClient.POSTExchangeParams(ctx, remoteURL, n32.SecParamExchReqData{
+		N32fContextId:          n32fContextID,
+		IpxProviderSecInfoList: &localIpxProviders,
+		Sender:                 model.FQDN(fqdn),
+	})
+	if err != nil {
+		return err
+	}
+	if rspData.IpxProviderSecInfoList != nil {
+		prinsContext.RemoteIpxProviderSecInfoList = *rspData.IpxProviderSecInfoList
+	}
+	return nil
+}
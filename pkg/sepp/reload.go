@@ -0,0 +1,126 @@
+package sepp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dot-5g/sepp/config"
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+)
+
+// Reload applies conf without dropping traffic. Roaming partners that
+// were added are peered with, those that were removed are told to
+// terminate their N32-f contexts within ctx, and the routes and policies
+// are replaced. A conf failing validation, or whose files cannot be
+// loaded, is rejected and the previous one is kept in use.
+//
+// The local N32 and SBI interfaces are only configured by New, changes to
+// them are ignored until the next restart.
+func (s *SEPP) Reload(ctx context.Context, conf config.Config) error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	if err := conf.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	s.mu.Lock()
+	previous := s.config
+	s.mu.Unlock()
+	if conf.SEPP.Local.N32 != previous.SEPP.Local.N32 || conf.SEPP.Local.SBI != previous.SEPP.Local.SBI {
+		s.logger.Printf("SEPP ignoring changes to the local N32 and SBI interfaces, they require a restart")
+		conf.SEPP.Local.N32 = previous.SEPP.Local.N32
+		conf.SEPP.Local.SBI = previous.SEPP.Local.SBI
+	}
+	settings, err := newSettings(conf)
+	if err != nil {
+		return err
+	}
+
+	added, removed := diffRemoteSEPPs(remoteSEPPs(previous.SEPP.Remotes), settings.RemoteSEPPs)
+	// Everything that can fail is prepared before anything is applied.
+	addedPeers := make([]*n32.Peer, 0, len(added))
+	for _, remoteSEPP := range added {
+		n32Peer, err := s.n32Peers.NewPeer(remoteSEPP)
+		if err != nil {
+			for _, addedPeer := range addedPeers {
+				s.n32Peers.Discard(addedPeer)
+			}
+			return err
+		}
+		addedPeers = append(addedPeers, n32Peer)
+	}
+	if err := s.localForwarder.SetRoutes(plmnId(conf.SEPP.Local.PlmnID), localRoutes(conf.SEPP.Local.Routes)); err != nil {
+		for _, addedPeer := range addedPeers {
+			s.n32Peers.Discard(addedPeer)
+		}
+		return err
+	}
+
+	// Peers are added before the settings routing to them.
+	for _, n32Peer := range addedPeers {
+		s.n32Peers.Add(n32Peer)
+	}
+	s.seppContext.UpdateSettings(settings)
+	s.mu.Lock()
+	s.config = conf
+	if s.ctx != nil {
+		for _, n32Peer := range addedPeers {
+			s.startHandshake(n32Peer)
+		}
+	}
+	stopped := make([]<-chan struct{}, len(removed))
+	for i, remoteSEPP := range removed {
+		stopped[i] = s.stopHandshake(remoteSEPP.URL)
+	}
+	s.mu.Unlock()
+
+	// A handshake in progress may still store a context until it returns.
+	for i, remoteSEPP := range removed {
+		if stopped[i] != nil {
+			<-stopped[i]
+		}
+		s.removePeer(ctx, remoteSEPP.URL)
+	}
+	s.logger.Printf("SEPP reloaded configuration: %d remote SEPPs added or updated, %d removed", len(added), len(removed))
+	return nil
+}
+
+// removePeer terminates the N32-f contexts with the remote SEPP reachable
+// at remoteURL and drops its connections. Contexts are forgotten even if
+// the remote SEPP cannot be told.
+func (s *SEPP) removePeer(ctx context.Context, remoteURL string) {
+	n32Peer, ok := s.n32Peers.Get(remoteURL)
+	if !ok {
+		return
+	}
+	terminatePeerN32fContexts(ctx, s.seppContext, n32Peer)
+	for _, n32fContext := range s.seppContext.ListN32fContexts() {
+		if string(n32fContext.RemoteN32FQDN) == remoteURL {
+			s.seppContext.RemoveN32fContext(n32fContext.N32fContextID)
+		}
+	}
+	s.n32Peers.Remove(remoteURL)
+}
+
+// diffRemoteSEPPs returns the remote SEPPs of next that are new or whose
+// TLS files changed, and those of previous that are gone. A remote SEPP
+// is identified by its URL.
+func diffRemoteSEPPs(previous, next []model.RemoteSEPP) (added, removed []model.RemoteSEPP) {
+	previousByURL := make(map[string]model.RemoteSEPP, len(previous))
+	for _, remoteSEPP := range previous {
+		previousByURL[remoteSEPP.URL] = remoteSEPP
+	}
+	nextByURL := make(map[string]model.RemoteSEPP, len(next))
+	for _, remoteSEPP := range next {
+		nextByURL[remoteSEPP.URL] = remoteSEPP
+		if old, ok := previousByURL[remoteSEPP.URL]; !ok || old.ClientCert != remoteSEPP.ClientCert || old.ClientKey != remoteSEPP.ClientKey || old.CA != remoteSEPP.CA {
+			added = append(added, remoteSEPP)
+		}
+	}
+	for _, remoteSEPP := range previous {
+		if _, ok := nextByURL[remoteSEPP.URL]; !ok {
+			removed = append(removed, remoteSEPP)
+		}
+	}
+	return added, removed
+}
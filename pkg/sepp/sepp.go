@@ -0,0 +1,383 @@
+// Package sepp runs a Security Edge Protection Proxy that can be embedded
+// in other Go programs.
+package sepp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dot-5g/sepp/config"
+	"github.com/dot-5g/sepp/internal/certs"
+	"github.com/dot-5g/sepp/internal/model"
+	"github.com/dot-5g/sepp/internal/n32"
+	"github.com/dot-5g/sepp/internal/sbi"
+)
+
+var (
+	// ErrInvalidConfig is returned by New when the configuration is
+	// rejected, wrapping a *config.ValidationError listing the violations.
+	ErrInvalidConfig = errors.New("invalid config")
+	// ErrCertLoad is returned by New when a certificate or its private
+	// key cannot be loaded after the configuration was validated, as
+	// when a file is removed in between.
+	ErrCertLoad = certs.ErrCertLoad
+	// ErrInvalidCA is returned by New when a CA file cannot be read after
+	// the configuration was validated.
+	ErrInvalidCA = certs.ErrInvalidCA
+	// ErrListen is returned by Start when an address cannot be bound.
+	ErrListen = errors.New("failed to listen")
+)
+
+// DefaultCertReloadInterval is how often certificate, key and CA files are
+// checked for changes unless set with WithCertReloadInterval.
+const DefaultCertReloadInterval = 30 * time.Second
+
+// Option customizes a SEPP created with New.
+type Option func(*SEPP)
+
+// WithLogger sends the messages of the SEPP to logger instead of the
+// standard logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(s *SEPP) {
+		s.logger = logger
+	}
+}
+
+// WithCertReloadInterval sets how often the certificate, key and CA files
+// are checked for changes. Zero disables the checks, leaving reloads to
+// ReloadCertificates.
+func WithCertReloadInterval(interval time.Duration) Option {
+	return func(s *SEPP) {
+		s.certReloadInterval = interval
+	}
+}
+
+// WithN32fTermination makes Stop terminate the N32-f contexts established
+// with the remote SEPPs before the N32 server is shut down.
+func WithN32fTermination() Option {
+	return func(s *SEPP) {
+		s.terminateOnStop = true
+	}
+}
+
+// SEPP serves the N32 interface towards the remote SEPPs and the SBI
+// towards the local NFs.
+type SEPP struct {
+	logger             *log.Logger
+	terminateOnStop    bool
+	certReloadInterval time.Duration
+
+	certs          *certs.Watcher
+	seppContext    *model.SEPPContext
+	n32Peers       *n32.PeerManager
+	n32Server      *n32.Server
+	sbiServer      *sbi.Server
+	localForwarder *sbi.LocalForwarder
+
+	n32Listener net.Listener
+	sbiListener net.Listener
+	errs        chan error
+	ready       chan struct{}
+	cancel      context.CancelFunc
+	background  sync.WaitGroup
+
+	// reloading serializes the reloads of the configuration.
+	reloading sync.Mutex
+	// mu guards the configuration in use and the handshakes in progress.
+	mu         sync.Mutex
+	config     config.Config
+	ctx        context.Context
+	handshakes map[string]handshake
+}
+
+// handshake is an N32-c handshake running in the background.
+type handshake struct {
+	cancel context.CancelFunc
+	done   <-chan struct{}
+}
+
+// Peer is the state of the peering with a remote SEPP.
+type Peer struct {
+	PlmnID       config.PlmnID
+	URL          string
+	N32fContexts []N32fContext
+}
+
+// N32fContext is an N32-f context established with a remote SEPP.
+type N32fContext struct {
+	ID                 string
+	SecurityCapability string
+	// N32fURL is where N32-f traffic to the remote SEPP is sent.
+	N32fURL string
+}
+
+// New validates conf and prepares the servers and the connections to the
+// remote SEPPs. Nothing is served before Start is called.
+func New(conf config.Config, opts ...Option) (*SEPP, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	s := &SEPP{
+		config:             conf,
+		handshakes:         make(map[string]handshake),
+		logger:             log.Default(),
+		certReloadInterval: DefaultCertReloadInterval,
+		errs:               make(chan error, 2),
+		ready:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	seppContext, err := newSEPPContext(conf, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	watcher := certs.NewWatcher(s.logger)
+	n32Store, err := watcher.Load(conf.SEPP.Local.N32.TLS.Cert, conf.SEPP.Local.N32.TLS.Key, conf.SEPP.Local.N32.TLS.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load N32 TLS material: %w", err)
+	}
+	sbiStore, err := watcher.Load(conf.SEPP.Local.SBI.TLS.Cert, conf.SEPP.Local.SBI.TLS.Key, conf.SEPP.Local.SBI.TLS.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SBI TLS material: %w", err)
+	}
+	localForwarder, err := sbi.NewLocalForwarder(plmnId(conf.SEPP.Local.PlmnID), localRoutes(conf.SEPP.Local.Routes), sbiStore, s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure forwarding to local NFs: %w", err)
+	}
+	n32Server, err := n32.NewServer(conf.SEPP.Local.N32.GetAddress(), n32Store, seppContext, localForwarder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure N32 server: %w", err)
+	}
+	n32Peers, err := n32.NewPeerManager(seppContext.Settings().RemoteSEPPs, watcher, s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure remote SEPPs: %w", err)
+	}
+	sbiServer, err := sbi.NewServer(conf.SEPP.Local.SBI.GetAddress(), sbiStore, seppContext, n32Peers, s.goBackground)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure SBI server: %w", err)
+	}
+	s.certs = watcher
+	s.localForwarder = localForwarder
+	s.seppContext = seppContext
+	s.n32Peers = n32Peers
+	s.n32Server = n32Server
+	s.sbiServer = sbiServer
+	return s, nil
+}
+
+// Start listens on the N32 and SBI addresses, serves them in the
+// background and performs the N32-c handshake with every remote SEPP.
+// Handshakes are retried until they succeed, ctx is done or Stop is
+// called. Ready is closed once all of them succeeded. Certificate files
+// are watched for changes until ctx is done or Stop is called.
+func (s *SEPP) Start(ctx context.Context) error {
+	n32Listener, err := net.Listen("tcp", s.n32Server.Addr())
+	if err != nil {
+		return fmt.Errorf("%w on N32 address: %w", ErrListen, err)
+	}
+	sbiListener, err := net.Listen("tcp", s.sbiServer.Addr())
+	if err != nil {
+		n32Listener.Close()
+		return fmt.Errorf("%w on SBI address: %w", ErrListen, err)
+	}
+	s.n32Listener = n32Listener
+	s.sbiListener = sbiListener
+	go s.serve(s.n32Server.Serve, n32Listener)
+	go s.serve(s.sbiServer.Serve, sbiListener)
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	if s.certReloadInterval > 0 {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.certs.Run(ctx, s.certReloadInterval)
+		}()
+	}
+	s.mu.Lock()
+	s.ctx = ctx
+	var handshakes []<-chan struct{}
+	for _, remoteSEPP := range s.seppContext.Settings().RemoteSEPPs {
+		if n32Peer, ok := s.n32Peers.Get(remoteSEPP.URL); ok {
+			handshakes = append(handshakes, s.startHandshake(n32Peer))
+		}
+	}
+	s.mu.Unlock()
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		for _, done := range handshakes {
+			<-done
+		}
+		if ctx.Err() == nil {
+			s.logger.Printf("SEPP ready to serve")
+			close(s.ready)
+		}
+	}()
+	return nil
+}
+
+// startHandshake performs the N32-c handshake with the remote SEPP of
+// n32Peer in the background until it succeeds, the SEPP stops or the
+// remote SEPP is removed. It must be called with mu held.
+func (s *SEPP) startHandshake(n32Peer *n32.Peer) <-chan struct{} {
+	remoteURL := n32Peer.RemoteSEPP.URL
+	if running, ok := s.handshakes[remoteURL]; ok {
+		running.cancel()
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	fqdn := s.config.SEPP.Local.N32.FQDN
+	done := make(chan struct{})
+	s.handshakes[remoteURL] = handshake{cancel: cancel, done: done}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer close(done)
+		defer cancel()
+		exchangeCapability(ctx, n32Peer, fqdn, s.seppContext)
+	}()
+	return done
+}
+
+// goBackground runs task in the background until it returns, with a
+// context done once the SEPP stops. Tasks are dropped before Start and
+// after Stop.
+func (s *SEPP) goBackground(task func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		return
+	}
+	ctx := s.ctx
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		task(ctx)
+	}()
+}
+
+// stopHandshake cancels the handshake in progress with the remote SEPP
+// reachable at remoteURL, if any, and returns a channel closed once it
+// has returned. It must be called with mu held.
+func (s *SEPP) stopHandshake(remoteURL string) <-chan struct{} {
+	running, ok := s.handshakes[remoteURL]
+	if !ok {
+		return nil
+	}
+	running.cancel()
+	delete(s.handshakes, remoteURL)
+	return running.done
+}
+
+func (s *SEPP) serve(serve func(net.Listener) error, listener net.Listener) {
+	if err := serve(listener); err != nil {
+		s.errs <- err
+	}
+}
+
+// ReloadCertificates loads all certificate, key and CA files again. The
+// files that fail to load keep their previous content in use and are
+// reported in the returned error.
+func (s *SEPP) ReloadCertificates() error {
+	return s.certs.Reload()
+}
+
+// Stop waits for the background tasks, drains the SBI server, optionally
+// terminates the N32-f contexts, then drains the N32 server. Tasks and
+// requests still in flight when ctx is done are dropped and an error is
+// returned.
+func (s *SEPP) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	// No task is started once ctx is cleared, so that none is added
+	// while waiting.
+	s.mu.Lock()
+	s.ctx = nil
+	s.mu.Unlock()
+	var errs []error
+	stopped := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("failed to wait for background tasks: %w", ctx.Err()))
+	}
+	// Local NFs are drained first as their requests need the N32-f
+	// contexts, then remote SEPPs once told to stop sending.
+	if err := s.sbiServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain SBI server: %w", err))
+	}
+	if s.terminateOnStop {
+		terminateN32fContexts(ctx, s.seppContext, s.n32Peers)
+	}
+	if err := s.n32Server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain N32 server: %w", err))
+	}
+	s.n32Peers.CloseIdleConnections()
+	return errors.Join(errs...)
+}
+
+// Err receives the error of a server that stopped before Stop was called.
+func (s *SEPP) Err() <-chan error {
+	return s.errs
+}
+
+// Ready is closed once an N32-f context is established with every remote
+// SEPP.
+func (s *SEPP) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// N32Addr returns the address the N32 server listens on, nil before Start.
+func (s *SEPP) N32Addr() net.Addr {
+	if s.n32Listener == nil {
+		return nil
+	}
+	return s.n32Listener.Addr()
+}
+
+// SBIAddr returns the address the SBI server listens on, nil before Start.
+func (s *SEPP) SBIAddr() net.Addr {
+	if s.sbiListener == nil {
+		return nil
+	}
+	return s.sbiListener.Addr()
+}
+
+// Peers returns the state of the peering with every configured remote
+// SEPP.
+func (s *SEPP) Peers() []Peer {
+	s.mu.Lock()
+	remotes := s.config.SEPP.Remotes
+	s.mu.Unlock()
+	n32fContexts := s.seppContext.ListN32fContexts()
+	sort.Slice(n32fContexts, func(i, j int) bool {
+		return n32fContexts[i].N32fContextID < n32fContexts[j].N32fContextID
+	})
+	peers := make([]Peer, 0, len(remotes))
+	for _, remote := range remotes {
+		peer := Peer{PlmnID: remote.PlmnID, URL: remote.URL}
+		for _, n32fContext := range n32fContexts {
+			if string(n32fContext.RemoteN32FQDN) == remote.URL {
+				peer.N32fContexts = append(peer.N32fContexts, N32fContext{
+					ID:                 n32fContext.N32fContextID,
+					SecurityCapability: string(n32fContext.SecurityCapability),
+					N32fURL:            n32fContext.N32fURL(),
+				})
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers
+}
@@ -0,0 +1,463 @@
+package sepp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dot-5g/sepp/config"
+	"github.com/dot-5g/sepp/pkg/pki"
+	"github.com/dot-5g/sepp/pkg/sepp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// writePKI writes a CA and a certificate for 127.0.0.1 signed by it,
+// usable by both servers and clients, to dir.
+func writePKI(t *testing.T, dir string) config.TLS {
+	ca, err := pki.NewCA(pki.Options{CommonName: "Test CA", Validity: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	keyPair, err := ca.Issue(pki.Options{CommonName: "sepp.example.com", Hosts: []string{"127.0.0.1"}, Validity: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	files := config.TLS{
+		Cert: filepath.Join(dir, "sepp.crt"),
+		Key:  filepath.Join(dir, "sepp.key"),
+		CA:   filepath.Join(dir, "ca.crt"),
+	}
+	if err := keyPair.WriteFiles(files.Cert, files.Key); err != nil {
+		t.Fatalf("Failed to write key pair: %v", err)
+	}
+	if err := pki.WriteCertificate(files.CA, ca.Certificate); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+	return files
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func newConfig(tlsFiles config.TLS, n32Port string, remotePlmnID config.PlmnID, remoteN32Port string) config.Config {
+	return config.Config{SEPP: config.SEPP{
+		SecurityCapabilities: []string{"TLS"},
+		Local: config.Local{
+			N32: config.N32{FQDN: "https://127.0.0.1:" + n32Port, Host: "127.0.0.1", Port: n32Port, TLS: tlsFiles},
+			SBI: config.SBI{FQDN: "sepp.example.com", Host: "127.0.0.1", Port: "0", TLS: tlsFiles},
+		},
+		Remotes: []config.Remote{
+			{PlmnID: remotePlmnID, URL: "https://127.0.0.1:" + remoteN32Port, TLS: tlsFiles},
+		},
+	}}
+}
+
+func startSEPP(t *testing.T, conf config.Config) *sepp.SEPP {
+	s, err := sepp.New(conf, sepp.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Failed to create SEPP: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start SEPP: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Stop(ctx); err != nil {
+			t.Errorf("Failed to stop SEPP: %v", err)
+		}
+	})
+	return s
+}
+
+func TestGivenTwoSEPPsWhenStartedThenRequestsReachRemoteNF(t *testing.T) {
+	nf := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "am-data")
+	}), &http2.Server{}))
+	defer nf.Close()
+
+	tlsFiles := writePKI(t, t.TempDir())
+	n32PortA, n32PortB := freePort(t), freePort(t)
+	confA := newConfig(tlsFiles, n32PortA, config.PlmnID{MCC: "002", MNC: "02"}, n32PortB)
+	confB := newConfig(tlsFiles, n32PortB, config.PlmnID{MCC: "001", MNC: "01"}, n32PortA)
+	confB.SEPP.Local.Routes = []config.Route{{ApiPrefix: "/nudm-sdm/", ApiRoot: nf.URL, H2C: true}}
+	seppA := startSEPP(t, confA)
+	seppB := startSEPP(t, confB)
+
+	for _, s := range []*sepp.SEPP{seppA, seppB} {
+		select {
+		case <-s.Ready():
+		case <-time.After(10 * time.Second):
+			t.Fatalf("SEPP not ready, peers: %+v", s.Peers())
+		}
+	}
+	peers := seppA.Peers()
+	if len(peers) != 1 || len(peers[0].N32fContexts) == 0 || peers[0].N32fContexts[0].SecurityCapability != "TLS" {
+		t.Fatalf("Expected a TLS N32-f context with the remote SEPP, got %+v", peers)
+	}
+
+	client := newClient(t, tlsFiles)
+	resp, err := client.Get("https://" + seppA.SBIAddr().String() + "/nudm-sdm/v2/imsi-001010000000001/am-data")
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "am-data" {
+		t.Errorf("Expected 200 from the remote NF, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func newClient(t *testing.T, tlsFiles config.TLS) *http.Client {
+	cert, err := tls.LoadX509KeyPair(tlsFiles.Cert, tlsFiles.Key)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	caCert, err := os.ReadFile(tlsFiles.CA)
+	if err != nil {
+		t.Fatalf("Failed to read CA certificate: %v", err)
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caCertPool,
+	}}}
+}
+
+func TestGivenInvalidConfigWhenNewThenErrorIsReturned(t *testing.T) {
+	conf := newConfig(config.TLS{Cert: "sepp.crt", Key: "sepp.key", CA: "ca.crt"}, "1231", config.PlmnID{MCC: "1", MNC: "01"}, "1233")
+
+	_, err := sepp.New(conf)
+
+	if !errors.Is(err, sepp.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestGivenMissingCertificateWhenNewThenErrInvalidConfigIsReturned(t *testing.T) {
+	dir := t.TempDir()
+	tlsFiles := writePKI(t, dir)
+	tlsFiles.Cert = filepath.Join(dir, "missing.crt")
+	conf := newConfig(tlsFiles, "1231", config.PlmnID{MCC: "001", MNC: "01"}, "1233")
+
+	_, err := sepp.New(conf)
+
+	var validationErr *config.ValidationError
+	if !errors.Is(err, sepp.ErrInvalidConfig) || !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ErrInvalidConfig, got %v", err)
+	}
+	if validationErr.Errors[0].Path != "sepp.local.n32.tls.cert" {
+		t.Errorf("Expected the missing certificate to be reported at sepp.local.n32.tls.cert, got %v", validationErr.Errors)
+	}
+}
+
+func TestGivenBusyAddressWhenStartThenErrListenIsReturned(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	s, err := sepp.New(newConfig(writePKI(t, t.TempDir()), port, config.PlmnID{MCC: "001", MNC: "01"}, "1233"))
+	if err != nil {
+		t.Fatalf("Failed to create SEPP: %v", err)
+	}
+
+	err = s.Start(context.Background())
+
+	if !errors.Is(err, sepp.ErrListen) {
+		t.Errorf("Expected ErrListen, got %v", err)
+	}
+}
+
+// waitForN32fContexts waits until s has n N32-f contexts with its first
+// remote SEPP.
+func waitForN32fContexts(t *testing.T, s *sepp.SEPP, n int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		peers := s.Peers()
+		if len(peers) > 0 && len(peers[0].N32fContexts) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d N32-f contexts, got peers %+v", n, peers)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestGivenRemovedAndAddedRemoteWhenReloadThenPeeringFollows(t *testing.T) {
+	tlsFiles := writePKI(t, t.TempDir())
+	n32PortA, n32PortB := freePort(t), freePort(t)
+	confA := newConfig(tlsFiles, n32PortA, config.PlmnID{MCC: "002", MNC: "02"}, n32PortB)
+	confB := newConfig(tlsFiles, n32PortB, config.PlmnID{MCC: "001", MNC: "01"}, n32PortA)
+	seppA := startSEPP(t, confA)
+	seppB := startSEPP(t, confB)
+	<-seppA.Ready()
+	<-seppB.Ready()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	withoutRemote := confA
+	withoutRemote.SEPP.Remotes = nil
+	if err := seppA.Reload(ctx, withoutRemote); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	if peers := seppA.Peers(); len(peers) != 0 {
+		t.Errorf("Expected no remote SEPP, got %+v", peers)
+	}
+	// Both ends hold the contexts initiated by either of them.
+	waitForN32fContexts(t, seppB, 0)
+
+	if err := seppA.Reload(ctx, confA); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+
+	waitForN32fContexts(t, seppA, 1)
+	waitForN32fContexts(t, seppB, 1)
+}
+
+func TestGivenInvalidConfigWhenReloadThenPreviousConfigIsKept(t *testing.T) {
+	tlsFiles := writePKI(t, t.TempDir())
+	conf := newConfig(tlsFiles, freePort(t), config.PlmnID{MCC: "001", MNC: "01"}, freePort(t))
+	s, err := sepp.New(conf, sepp.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Failed to create SEPP: %v", err)
+	}
+	invalid := conf
+	invalid.SEPP.Remotes = []config.Remote{{PlmnID: config.PlmnID{MCC: "1", MNC: "01"}, URL: "https://127.0.0.1:1", TLS: tlsFiles}}
+
+	err = s.Reload(context.Background(), invalid)
+
+	if !errors.Is(err, sepp.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+	if peers := s.Peers(); len(peers) != 1 || peers[0].PlmnID.MCC != "001" {
+		t.Errorf("Expected the previous remote SEPP to be kept, got %+v", peers)
+	}
+}
+
+// logBuffer collects the logs of a SEPP.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestGivenRemoteAnsweringAsAnotherSEPPWhenStartedThenNoContextIsEstablished(t *testing.T) {
+	tlsFiles := writePKI(t, t.TempDir())
+	cert, err := tls.LoadX509KeyPair(tlsFiles.Cert, tlsFiles.Key)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"sender": "https://other-sepp.example.com", "selectedSecCapability": "TLS"}`)
+	}))
+	remote.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	remote.StartTLS()
+	defer remote.Close()
+	_, remotePort, _ := net.SplitHostPort(remote.Listener.Addr().String())
+	conf := newConfig(tlsFiles, freePort(t), config.PlmnID{MCC: "002", MNC: "02"}, remotePort)
+	conf.SEPP.Remotes = append(conf.SEPP.Remotes, config.Remote{PlmnID: config.PlmnID{MCC: "003", MNC: "03"}, URL: "https://other-sepp.example.com", TLS: tlsFiles})
+	logs := &logBuffer{}
+	s, err := sepp.New(conf, sepp.WithLogger(log.New(logs, "", 0)))
+	if err != nil {
+		t.Fatalf("Failed to create SEPP: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start SEPP: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Stop(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "answered as https://other-sepp.example.com") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the answer to be rejected, got logs:\n%s", logs)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for _, peer := range s.Peers() {
+		if len(peer.N32fContexts) != 0 {
+			t.Errorf("Expected no N32-f context, got %+v", peer)
+		}
+	}
+}
+
+func TestGivenHandshakeInProgressWhenStopThenItIsCancelled(t *testing.T) {
+	tlsFiles := writePKI(t, t.TempDir())
+	cert, err := tls.LoadX509KeyPair(tlsFiles.Cert, tlsFiles.Key)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	remote.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	remote.StartTLS()
+	defer remote.Close()
+	defer close(release)
+	_, remotePort, _ := net.SplitHostPort(remote.Listener.Addr().String())
+	s, err := sepp.New(newConfig(tlsFiles, freePort(t), config.PlmnID{MCC: "002", MNC: "02"}, remotePort), sepp.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("Failed to create SEPP: %v", err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start SEPP: %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Exchange capability not received")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Stop(ctx)
+
+	if err != nil {
+		t.Errorf("Failed to stop SEPP: %v", err)
+	}
+}
+
+func TestGivenFailedParameterExchangeWhenStartedThenContextIsTerminatedAndNotUsed(t *testing.T) {
+	tlsFiles := writePKI(t, t.TempDir())
+	cert, err := tls.LoadX509KeyPair(tlsFiles.Cert, tlsFiles.Key)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	terminated := make(chan string, 16)
+	var remoteURL string
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/n32c-handshake/v1/exchange-capability":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"sender": "`+remoteURL+`", "selectedSecCapability": "PRINS"}`)
+		case "/n32c-handshake/v1/n32f-terminate":
+			body, _ := io.ReadAll(r.Body)
+			terminated <- string(body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	remote.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	remote.StartTLS()
+	defer remote.Close()
+	_, remotePort, _ := net.SplitHostPort(remote.Listener.Addr().String())
+	remoteURL = "https://127.0.0.1:" + remotePort
+	conf := newConfig(tlsFiles, freePort(t), config.PlmnID{MCC: "002", MNC: "02"}, remotePort)
+	conf.SEPP.SecurityCapabilities = []string{"PRINS"}
+	s := startSEPP(t, conf)
+
+	select {
+	case body := <-terminated:
+		if !strings.Contains(body, "n32fContextId") {
+			t.Errorf("Expected the N32-f context to be terminated, got %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("N32-f context not terminated on the remote SEPP")
+	}
+	for _, peer := range s.Peers() {
+		if len(peer.N32fContexts) != 0 {
+			t.Errorf("Expected no N32-f context, got %+v", peer)
+		}
+	}
+}
+
+func TestGivenHandshakeInProgressWhenRemoteIsRemovedThenReloadCancelsIt(t *testing.T) {
+	tlsFiles := writePKI(t, t.TempDir())
+	cert, err := tls.LoadX509KeyPair(tlsFiles.Cert, tlsFiles.Key)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	remote.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	remote.StartTLS()
+	defer remote.Close()
+	defer close(release)
+	_, remotePort, _ := net.SplitHostPort(remote.Listener.Addr().String())
+	conf := newConfig(tlsFiles, freePort(t), config.PlmnID{MCC: "002", MNC: "02"}, remotePort)
+	s := startSEPP(t, conf)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Exchange capability not received")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	withoutRemote := conf
+	withoutRemote.SEPP.Remotes = nil
+	err = s.Reload(ctx, withoutRemote)
+
+	if err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Reload waited for the handshake to time out")
+	}
+	if peers := s.Peers(); len(peers) != 0 {
+		t.Errorf("Expected no remote SEPP, got %+v", peers)
+	}
+}